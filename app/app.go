@@ -0,0 +1,108 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+
+	"oos/config"
+	"oos/middleware"
+	"oos/repository"
+	"oos/service"
+)
+
+// App owns everything one instance of the server runs on. Instances share no
+// state, so several can run in one process; only the Gin mode is set for the
+// whole process, by main.
+type App struct {
+	Config       *config.Config
+	Logger       *zap.Logger
+	Level        zap.AtomicLevel
+	DB           *mongo.Client
+	Repositories repository.Repositories
+	Service      *service.Service
+	Auth         *middleware.Auth
+	CORS         *middleware.CORS
+
+	reload sync.Mutex
+}
+
+// New builds an application on repos that logs to lg, whose level Reload
+// changes. client is the database repos are kept in, or nil if they need none,
+// and is disconnected by Close.
+func New(cfg *config.Config, lg *zap.Logger, level zap.AtomicLevel, client *mongo.Client, repos repository.Repositories) (*App, error) {
+	svc := service.New(cfg, lg, repos)
+
+	auth, err := middleware.NewAuth(cfg, lg, svc)
+	if err != nil {
+		return nil, err
+	}
+
+	return &App{
+		Config:       cfg,
+		Logger:       lg,
+		Level:        level,
+		DB:           client,
+		Repositories: repos,
+		Service:      svc,
+		Auth:         auth,
+		CORS:         middleware.NewCORS(cfg.CORS),
+	}, nil
+}
+
+// NewMemory builds an application that keeps its data in memory and logs
+// nowhere, e.g. to serve tests.
+func NewMemory(cfg *config.Config) (*App, error) {
+	return New(cfg, zap.NewNop(), zap.NewAtomicLevel(), nil, repository.NewMemory())
+}
+
+// reloadable are the settings Reload applies to a running application. The
+// server has no rate limits or feature flags to reload; settings for them
+// would join this list and be swapped in like the CORS lists.
+var reloadable = map[string]bool{
+	"log.level":         true,
+	"cors.alloworigins": true,
+	"cors.allowmethods": true,
+	"cors.allowheaders": true,
+}
+
+// Reload applies the reloadable settings of a validated cfg and returns a
+// warning for every other setting that changed, which takes a restart.
+func (a *App) Reload(cfg *config.Config) ([]string, error) {
+	a.reload.Lock()
+	defer a.reload.Unlock()
+
+	var warnings []string
+	for _, name := range a.Config.Changed(cfg) {
+		if !reloadable[name] {
+			warnings = append(warnings, fmt.Sprintf("%s changed but takes a restart to apply", name))
+		}
+	}
+
+	if err := a.Level.UnmarshalText([]byte(cfg.Log.Level)); err != nil {
+		return warnings, err
+	}
+	a.CORS.Update(cfg.CORS)
+
+	// Only the applied settings are kept, so a pending restart is reported
+	// again on the next reload.
+	a.Config.Log.Level = cfg.Log.Level
+	a.Config.CORS = cfg.CORS
+
+	return warnings, nil
+}
+
+// Close disconnects the database and flushes the logger.
+func (a *App) Close(ctx context.Context) error {
+	if a.DB != nil {
+		if err := a.DB.Disconnect(ctx); err != nil {
+			return err
+		}
+	}
+
+	a.Logger.Sync()
+	return nil
+}
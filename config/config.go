@@ -1,30 +1,123 @@
 package config
 
 import (
+	"fmt"
+	"net"
 	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/pelletier/go-toml/v2"
+	"go.uber.org/zap/zapcore"
 )
 
 type Config struct {
-	Server struct {
-		Mode string
-		Port string
-	}
+	Server ServerConfig
+	DB     DBConfig
+	Auth   AuthConfig
+	Order  OrderConfig
+	Stock  StockConfig
+	Log    LogConfig
+	CORS   CORSConfig
+}
+
+type ServerConfig struct {
+	Mode string // debug, release or test
+	Port string
+}
+
+type DBConfig struct {
+	Host string
+	Name string
+}
+
+type AuthConfig struct {
+	Issuer     string
+	Audience   []string
+	Algorithm  string
+	Secret     string
+	SigningKey string
+	Keys       []AuthKey
+	AccessTTL  int // minutes
+	RefreshTTL int // minutes
+}
 
-	DB map[string]string
+// AuthKey is a PEM encoded key identified by the kid header of the tokens it signs.
+type AuthKey struct {
+	ID   string
+	File string
+}
+
+type OrderConfig struct {
+	TaxRate     float64
+	DeliveryFee float64
+}
+
+type StockConfig struct {
+	ResetAt     string // local time of day, 15:04
+	ResetPeriod int    // hours
+}
+
+type LogConfig struct {
+	Level   string
+	Fpath   string
+	Msize   int
+	Mage    int
+	Mbackup int
+}
 
-	Log struct {
-		Level   string
-		Fpath   string
-		Msize   int
-		Mage    int
-		Mbackup int
+// CORSConfig lists what cross-origin requests may use. An origin of "*"
+// allows every origin.
+type CORSConfig struct {
+	AllowOrigins []string
+	AllowMethods []string
+	AllowHeaders []string
+}
+
+// Default returns the settings used where neither the file nor the
+// environment sets one.
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Mode: "debug",
+			Port: ":8080",
+		},
+		DB: DBConfig{
+			Host: "mongodb://localhost:27017",
+			Name: "oos",
+		},
+		Auth: AuthConfig{
+			Issuer:     "oos",
+			Audience:   []string{"oos"},
+			Algorithm:  "HS256",
+			AccessTTL:  15,
+			RefreshTTL: 7 * 24 * 60,
+		},
+		Stock: StockConfig{
+			ResetAt:     "00:00",
+			ResetPeriod: 24,
+		},
+		Log: LogConfig{
+			Level:   "info",
+			Fpath:   "./logs/oos",
+			Msize:   100,
+			Mage:    7,
+			Mbackup: 5,
+		},
+		CORS: CORSConfig{
+			AllowOrigins: []string{"*"},
+			AllowMethods: []string{"POST", "OPTIONS", "GET", "PUT", "DELETE"},
+			AllowHeaders: []string{"Content-Type", "Content-Length", "Accept-Encoding", "X-CSRF-Token", "X-Forwarded-For", "Authorization", "accept", "origin", "Cache-Control", "X-Requested-With"},
+		},
 	}
 }
 
+// GetConfig reads the TOML file at fpath over the defaults and applies the
+// environment overrides. The result is not validated.
 func GetConfig(fpath string) (*Config, error) {
-	cfg := new(Config)
+	cfg := Default()
 
 	file, err := os.Open(fpath)
 	if err != nil {
@@ -36,8 +129,184 @@ func GetConfig(fpath string) (*Config, error) {
 		return nil, err
 	}
 
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+
 	return cfg, nil
 }
 
+// legacyEnv are the names some settings were read from before the OOS_
+// variables existed. The OOS_ variable wins if both are set.
+var legacyEnv = map[string]string{
+	"JWT_ISSUER":      "OOS_AUTH_ISSUER",
+	"JWT_AUDIENCE":    "OOS_AUTH_AUDIENCE",
+	"JWT_ALGORITHM":   "OOS_AUTH_ALGORITHM",
+	"JWT_SECRET":      "OOS_AUTH_SECRET",
+	"JWT_SIGNING_KEY": "OOS_AUTH_SIGNINGKEY",
+}
+
+// applyEnv overrides each setting with the variable OOS_<SECTION>_<NAME>,
+// e.g. OOS_SERVER_PORT or OOS_LOG_LEVEL. Lists are comma separated. Auth keys
+// can only be set in the file.
+func (cfg *Config) applyEnv() error {
+	env := map[string]string{}
+	for legacy, name := range legacyEnv {
+		if value, ok := os.LookupEnv(legacy); ok && value != "" {
+			env[name] = value
+		}
+	}
+	for _, pair := range os.Environ() {
+		if name, value, ok := strings.Cut(pair, "="); ok && strings.HasPrefix(name, "OOS_") {
+			env[name] = value
+		}
+	}
+
+	var problems []string
+	sections := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < sections.NumField(); i++ {
+		section := sections.Field(i)
+		for j := 0; j < section.NumField(); j++ {
+			field := section.Field(j)
+			name := "OOS_" + strings.ToUpper(sections.Type().Field(i).Name+"_"+section.Type().Field(j).Name)
+
+			value, ok := env[name]
+			if !ok {
+				continue
+			}
+			if err := setField(field, value); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+func setField(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(n))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("cannot be set from the environment")
+		}
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("cannot be set from the environment")
+	}
+
+	return nil
+}
+
+// ValidationError lists every problem found in a configuration.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate reports every setting the server cannot start with.
+func (cfg *Config) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	switch cfg.Server.Mode {
+	case "debug", "release", "test":
+	default:
+		check(false, "server.mode %q is not debug, release or test", cfg.Server.Mode)
+	}
+	_, _, err := net.SplitHostPort(cfg.Server.Port)
+	check(err == nil, "server.port %q is not a [host]:port address", cfg.Server.Port)
+
+	check(strings.HasPrefix(cfg.DB.Host, "mongodb://") || strings.HasPrefix(cfg.DB.Host, "mongodb+srv://"),
+		"db.host %q is not a mongodb:// or mongodb+srv:// URI", cfg.DB.Host)
+	check(cfg.DB.Name != "", "db.name is empty")
+
+	check(cfg.Auth.Issuer != "", "auth.issuer is empty")
+	check(len(cfg.Auth.Audience) > 0, "auth.audience is empty")
+	switch cfg.Auth.Algorithm {
+	case "HS256":
+		check(cfg.Auth.Secret != "", "auth.secret is empty, which HS256 requires")
+	case "RS256", "ES256":
+		check(len(cfg.Auth.Keys) > 0, "auth.keys is empty, which %s requires", cfg.Auth.Algorithm)
+		for i, key := range cfg.Auth.Keys {
+			check(key.ID != "", "auth.keys[%d].id is empty", i)
+			check(key.File != "", "auth.keys[%d].file is empty", i)
+		}
+	default:
+		check(false, "auth.algorithm %q is not HS256, RS256 or ES256", cfg.Auth.Algorithm)
+	}
+	check(cfg.Auth.AccessTTL > 0, "auth.accessttl %d is not positive", cfg.Auth.AccessTTL)
+	check(cfg.Auth.RefreshTTL > 0, "auth.refreshttl %d is not positive", cfg.Auth.RefreshTTL)
+
+	check(cfg.Order.TaxRate >= 0, "order.taxrate %v is negative", cfg.Order.TaxRate)
+	check(cfg.Order.DeliveryFee >= 0, "order.deliveryfee %v is negative", cfg.Order.DeliveryFee)
+
+	_, err = time.Parse("15:04", cfg.Stock.ResetAt)
+	check(err == nil, "stock.resetat %q is not a time of day like 00:00", cfg.Stock.ResetAt)
+	check(cfg.Stock.ResetPeriod > 0, "stock.resetperiod %d is not positive", cfg.Stock.ResetPeriod)
+
+	var level zapcore.Level
+	check(level.UnmarshalText([]byte(cfg.Log.Level)) == nil, "log.level %q is not a log level", cfg.Log.Level)
+	check(cfg.Log.Fpath != "", "log.fpath is empty")
+	check(cfg.Log.Msize >= 0, "log.msize %d is negative", cfg.Log.Msize)
+	check(cfg.Log.Mage >= 0, "log.mage %d is negative", cfg.Log.Mage)
+	check(cfg.Log.Mbackup >= 0, "log.mbackup %d is negative", cfg.Log.Mbackup)
+
+	check(len(cfg.CORS.AllowOrigins) > 0, "cors.alloworigins is empty")
+	check(len(cfg.CORS.AllowMethods) > 0, "cors.allowmethods is empty")
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// Changed lists the settings that differ between cfg and next by their
+// names in the file, e.g. log.level.
+func (cfg *Config) Changed(next *Config) []string {
+	var changed []string
+	before, after := reflect.ValueOf(cfg).Elem(), reflect.ValueOf(next).Elem()
+	for i := 0; i < before.NumField(); i++ {
+		for j := 0; j < before.Field(i).NumField(); j++ {
+			if !reflect.DeepEqual(before.Field(i).Field(j).Interface(), after.Field(i).Field(j).Interface()) {
+				section := before.Type().Field(i).Name
+				name := before.Field(i).Type().Field(j).Name
+				changed = append(changed, strings.ToLower(section+"."+name))
+			}
+		}
+	}
+
+	return changed
+}
+
 // References
 // Class material: lecture 12
@@ -1,34 +1,133 @@
 package controller
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
 
 	"oos/dto"
 	"oos/middleware"
 	"oos/model"
+	"oos/service"
 )
 
-//	@Summary		JWT login
-//	@Description	Authenticate to get access token
+// AccountHandler serves registration, login and the tokens that follow.
+type AccountHandler struct {
+	Service *service.Service
+	Auth    *middleware.Auth
+}
+
+//	@Summary		Register a new account
+//	@Description	Add a user document with a hashed password to the users collection
 //	@Tags			accounts
 //	@Accept			json
 //	@Produce		json
-//	@Success		200		{object}	model.Token
+//	@Param			account	body		dto.AccountCreate	true	"A new account to register"
+//	@Success		201		{object}	model.User
 //	@Failure		400		{object}	error
-//	@Failure		404		{object}	error
+//	@Failure		409		{object}	error
 //	@Failure		500		{object}	error
-//	@Param			role	path		string	true	"User role (permission or scope)"	Enums(customer, provider)
+//	@Router			/account/register [post]
+func (h *AccountHandler) Register(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// HTTP request
+	var account dto.AccountCreate
+	err := c.BindJSON(&account)
+	if err != nil {
+		dto.NewResponse().
+			SetCode(http.StatusBadRequest).
+			SetText(http.StatusText(http.StatusBadRequest)).
+			SetData(err.Error()).
+			AbortWithStatusJSON(c)
+		return
+	}
+
+	// Business logic
+	result, err := h.Service.CreateUser(ctx, account)
+	if errors.Is(err, service.ErrUserExists) {
+		dto.NewResponse().
+			SetCode(http.StatusConflict).
+			SetText(http.StatusText(http.StatusConflict)).
+			SetData(err.Error()).
+			SendJSON(c)
+		return
+	}
+	if err != nil {
+		dto.NewResponse().
+			SetCode(http.StatusInternalServerError).
+			SetText(http.StatusText(http.StatusInternalServerError)).
+			SetData(err.Error()).
+			SendJSON(c)
+		return
+	}
+
+	// HTTP response
+	dto.NewResponse().
+		SetCode(http.StatusCreated).
+		SetText(http.StatusText(http.StatusCreated)).
+		SetData(result).
+		SendJSON(c)
+}
+
+//	@Summary		JWT login
+//	@Description	Authenticate with username and password to get an access token for a role the user holds
+//	@Tags			accounts
+//	@Accept			json
+//	@Produce		json
+//	@Param			role		path		string				true	"User role (permission or scope)"	Enums(customer, provider)
+//	@Param			credentials	body		dto.AccountLogin	true	"Username and password"
+//	@Success		200			{object}	model.Token
+//	@Failure		400			{object}	error
+//	@Failure		401			{object}	error
+//	@Failure		403			{object}	error
+//	@Failure		500			{object}	error
 //	@Router			/account/login/{role} [post]
-func Login(c *gin.Context) {
+func (h *AccountHandler) Login(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
 	// HTTP request
 	role := c.Param("role")
 
+	var credentials dto.AccountLogin
+	err := c.BindJSON(&credentials)
+	if err != nil {
+		dto.NewResponse().
+			SetCode(http.StatusBadRequest).
+			SetText(http.StatusText(http.StatusBadRequest)).
+			SetData(err.Error()).
+			AbortWithStatusJSON(c)
+		return
+	}
+
 	// Business logic
-	token, err := middleware.CreateAccessToken(role)
+	user, err := h.Service.AuthenticateUser(ctx, role, credentials)
+	if errors.Is(err, service.ErrInvalidCredentials) {
+		dto.NewResponse().
+			SetCode(http.StatusUnauthorized).
+			SetText(http.StatusText(http.StatusUnauthorized)).
+			SetError(dto.ErrCodeInvalidCredentials).
+			SetData(err.Error()).
+			SendJSON(c)
+		return
+	}
+	if errors.Is(err, service.ErrRoleNotGranted) {
+		dto.NewResponse().
+			SetCode(http.StatusForbidden).
+			SetText(http.StatusText(http.StatusForbidden)).
+			SetError(dto.ErrCodeInsufficientScope).
+			SetData(err.Error()).
+			SendJSON(c)
+		return
+	}
 	if err != nil {
-		dto.Response.
+		dto.NewResponse().
 			SetCode(http.StatusInternalServerError).
 			SetText(http.StatusText(http.StatusInternalServerError)).
 			SetData(err.Error()).
@@ -36,15 +135,275 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	result := model.Token{
-		UserRole: role,
-		JwtToken: token,
+	result, err := h.issueTokens(user.Username, role)
+	if err != nil {
+		dto.NewResponse().
+			SetCode(http.StatusInternalServerError).
+			SetText(http.StatusText(http.StatusInternalServerError)).
+			SetData(err.Error()).
+			SendJSON(c)
+		return
 	}
 
 	// HTTP response
-	dto.Response.
+	dto.NewResponse().
 		SetCode(http.StatusOK).
 		SetText(http.StatusText(http.StatusOK)).
 		SetData(result).
 		SendJSON(c)
 }
+
+//	@Summary		Refresh tokens
+//	@Description	Exchange a refresh token for a new access token and refresh token; the old refresh token is revoked
+//	@Tags			accounts
+//	@Accept			json
+//	@Produce		json
+//	@Param			token	body		dto.TokenRefresh	true	"Refresh token"
+//	@Success		200		{object}	model.Token
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/account/refresh [post]
+func (h *AccountHandler) Refresh(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// HTTP request
+	var token dto.TokenRefresh
+	err := c.BindJSON(&token)
+	if err != nil {
+		dto.NewResponse().
+			SetCode(http.StatusBadRequest).
+			SetText(http.StatusText(http.StatusBadRequest)).
+			SetData(err.Error()).
+			AbortWithStatusJSON(c)
+		return
+	}
+
+	// Business logic
+	claims, err := h.Auth.ValidateRefreshToken(ctx, token.RefreshToken)
+	if err != nil {
+		status, errorCode := middleware.ClassifyTokenError(err)
+		dto.NewResponse().
+			SetCode(status).
+			SetText(http.StatusText(status)).
+			SetError(errorCode).
+			SetData(err.Error()).
+			SendJSON(c)
+		return
+	}
+
+	username := claims.RegisteredClaims.Subject
+	role := claims.CustomClaims.(*middleware.RefreshClaims).Scope
+
+	user, err := h.Service.GetUser(ctx, username)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		dto.NewResponse().
+			SetCode(http.StatusUnauthorized).
+			SetText(http.StatusText(http.StatusUnauthorized)).
+			SetError(dto.ErrCodeInvalidCredentials).
+			SetData(service.ErrInvalidCredentials.Error()).
+			SendJSON(c)
+		return
+	}
+	if err != nil {
+		dto.NewResponse().
+			SetCode(http.StatusInternalServerError).
+			SetText(http.StatusText(http.StatusInternalServerError)).
+			SetData(err.Error()).
+			SendJSON(c)
+		return
+	}
+	if !user.HasRole(role) {
+		dto.NewResponse().
+			SetCode(http.StatusForbidden).
+			SetText(http.StatusText(http.StatusForbidden)).
+			SetError(dto.ErrCodeInsufficientScope).
+			SetData(service.ErrRoleNotGranted.Error()).
+			SendJSON(c)
+		return
+	}
+
+	expiresAt := time.Unix(claims.RegisteredClaims.Expiry, 0)
+	if err := h.Service.RevokeToken(ctx, claims.RegisteredClaims.ID, username, expiresAt); err != nil {
+		dto.NewResponse().
+			SetCode(http.StatusInternalServerError).
+			SetText(http.StatusText(http.StatusInternalServerError)).
+			SetData(err.Error()).
+			SendJSON(c)
+		return
+	}
+
+	result, err := h.issueTokens(username, role)
+	if err != nil {
+		dto.NewResponse().
+			SetCode(http.StatusInternalServerError).
+			SetText(http.StatusText(http.StatusInternalServerError)).
+			SetData(err.Error()).
+			SendJSON(c)
+		return
+	}
+
+	// HTTP response
+	dto.NewResponse().
+		SetCode(http.StatusOK).
+		SetText(http.StatusText(http.StatusOK)).
+		SetData(result).
+		SendJSON(c)
+}
+
+//	@Summary		Logout
+//	@Description	Revoke the current access token and, if given, the refresh token issued with it
+//	@Tags			accounts
+//	@Accept			json
+//	@Produce		json
+//	@Param			token	body		dto.TokenRefresh	false	"Refresh token"
+//	@Success		200		{object}	dto.HTTPResponse
+//	@Failure		401		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/account/logout [post]
+//	@Security		ApiKeyAuth
+func (h *AccountHandler) Logout(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// HTTP request
+	claims, ok := middleware.TokenClaims(c)
+	if !ok {
+		dto.NewResponse().
+			SetCode(http.StatusUnauthorized).
+			SetText(http.StatusText(http.StatusUnauthorized)).
+			SetError(dto.ErrCodeTokenMissing).
+			SetData("missing access token").
+			AbortWithStatusJSON(c)
+		return
+	}
+	username := claims.RegisteredClaims.Subject
+
+	// The refresh token is optional.
+	var token dto.TokenRefresh
+	_ = c.ShouldBindJSON(&token)
+
+	// Business logic
+	expiresAt := time.Unix(claims.RegisteredClaims.Expiry, 0)
+	if err := h.Service.RevokeToken(ctx, claims.RegisteredClaims.ID, username, expiresAt); err != nil {
+		dto.NewResponse().
+			SetCode(http.StatusInternalServerError).
+			SetText(http.StatusText(http.StatusInternalServerError)).
+			SetData(err.Error()).
+			SendJSON(c)
+		return
+	}
+
+	if token.RefreshToken != "" {
+		refreshClaims, err := h.Auth.ValidateRefreshToken(ctx, token.RefreshToken)
+		if err == nil && refreshClaims.RegisteredClaims.Subject == username {
+			expiresAt := time.Unix(refreshClaims.RegisteredClaims.Expiry, 0)
+			if err := h.Service.RevokeToken(ctx, refreshClaims.RegisteredClaims.ID, username, expiresAt); err != nil {
+				dto.NewResponse().
+					SetCode(http.StatusInternalServerError).
+					SetText(http.StatusText(http.StatusInternalServerError)).
+					SetData(err.Error()).
+					SendJSON(c)
+				return
+			}
+		}
+	}
+
+	// HTTP response
+	dto.NewResponse().
+		SetCode(http.StatusOK).
+		SetText(http.StatusText(http.StatusOK)).
+		SetData(nil).
+		SendJSON(c)
+}
+
+//	@Summary		Grant a role
+//	@Description	Add a role to a registered user, e.g. to make a new provider
+//	@Tags			accounts
+//	@Accept			json
+//	@Produce		json
+//	@Param			username	path		string			true	"Username"
+//	@Param			role		body		dto.RoleGrant	true	"Role to grant"
+//	@Success		200			{object}	dto.HTTPResponse
+//	@Failure		400			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Router			/provider/accounts/{username}/roles [put]
+//	@Security		ApiKeyAuth
+func (h *AccountHandler) GrantRole(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// HTTP request
+	username := c.Param("username")
+
+	var grant dto.RoleGrant
+	err := c.BindJSON(&grant)
+	if err != nil {
+		dto.NewResponse().
+			SetCode(http.StatusBadRequest).
+			SetText(http.StatusText(http.StatusBadRequest)).
+			SetData(err.Error()).
+			AbortWithStatusJSON(c)
+		return
+	}
+
+	// Business logic
+	result, err := h.Service.GrantRole(ctx, username, grant.Role)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		dto.NewResponse().
+			SetCode(http.StatusNotFound).
+			SetText(http.StatusText(http.StatusNotFound)).
+			SetData(err.Error()).
+			SendJSON(c)
+		return
+	}
+	if err != nil {
+		dto.NewResponse().
+			SetCode(http.StatusInternalServerError).
+			SetText(http.StatusText(http.StatusInternalServerError)).
+			SetData(err.Error()).
+			SendJSON(c)
+		return
+	}
+
+	// HTTP response
+	dto.NewResponse().
+		SetCode(http.StatusOK).
+		SetText(http.StatusText(http.StatusOK)).
+		SetData(result).
+		SendJSON(c)
+}
+
+//	@Summary		JSON Web Key Set
+//	@Description	Public keys that verify tokens issued by this server, selected by the kid header (empty for HS256)
+//	@Tags			accounts
+//	@Produce		json
+//	@Success		200	{object}	object
+//	@Router			/account/jwks.json [get]
+func (h *AccountHandler) JWKS(c *gin.Context) {
+	// Served as a bare JWK set so that standard JWT libraries can consume it.
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.Auth.PublicKeys())
+}
+
+func (h *AccountHandler) issueTokens(username string, role string) (*model.Token, error) {
+	accessToken, err := h.Auth.CreateAccessToken(username, role)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := h.Auth.CreateRefreshToken(username, role)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.Token{
+		UserRole:     role,
+		JwtToken:     accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(h.Auth.AccessTokenTTL().Seconds()),
+	}, nil
+}
@@ -2,15 +2,26 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
 
 	"oos/dto"
+	"oos/middleware"
+	"oos/model"
 	"oos/service"
 )
 
+// OrderHandler serves orders to customers and providers.
+type OrderHandler struct {
+	Service *service.Service
+}
+
+var errNotOwner = errors.New("resource belongs to another user")
+
 //	@Summary		Create a new order
 //	@Description	Add an order document to the orders collection
 //	@Tags			orders
@@ -19,11 +30,12 @@ import (
 //	@Param			order	body		dto.OrderCreate	true	"A new order to submit"
 //	@Success		200		{object}	model.Order
 //	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
 //	@Failure		404		{object}	error
 //	@Failure		500		{object}	error
 //	@Router			/customer/orders [post]
 //	@Security		ApiKeyAuth
-func CreateOrder(c *gin.Context) {
+func (h *OrderHandler) CreateOrder(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -31,18 +43,37 @@ func CreateOrder(c *gin.Context) {
 	var order dto.OrderCreate
 	err := c.BindJSON(&order)
 	if err != nil {
-		dto.Response.
+		dto.NewResponse().
 			SetCode(http.StatusBadRequest).
 			SetText(http.StatusText(http.StatusBadRequest)).
 			SetData(err.Error()).
 			AbortWithStatusJSON(c)
 		return
 	}
+	if order.User.Username != middleware.Username(c) {
+		dto.NewResponse().
+			SetCode(http.StatusForbidden).
+			SetText(http.StatusText(http.StatusForbidden)).
+			SetError(dto.ErrCodeNotOwner).
+			SetData(errNotOwner.Error()).
+			AbortWithStatusJSON(c)
+		return
+	}
 
 	// Business logic
-	result, err := service.CreateOrder(ctx, order)
+	result, err := h.Service.CreateOrder(ctx, order)
+	var cartErr *service.CartError
+	if errors.As(err, &cartErr) {
+		dto.NewResponse().
+			SetCode(http.StatusBadRequest).
+			SetText(http.StatusText(http.StatusBadRequest)).
+			SetError(dto.ErrCodeInvalidCart).
+			SetData(cartErr.Lines).
+			SendJSON(c)
+		return
+	}
 	if err != nil {
-		dto.Response.
+		dto.NewResponse().
 			SetCode(http.StatusInternalServerError).
 			SetText(http.StatusText(http.StatusInternalServerError)).
 			SetData(err.Error()).
@@ -51,7 +82,7 @@ func CreateOrder(c *gin.Context) {
 	}
 
 	// HTTP response
-	dto.Response.
+	dto.NewResponse().
 		SetCode(http.StatusCreated).
 		SetText(http.StatusText(http.StatusCreated)).
 		SetData(result).
@@ -59,24 +90,52 @@ func CreateOrder(c *gin.Context) {
 }
 
 //	@Summary		List all orders
-//	@Description	Show all orders
+//	@Description	Show orders a page at a time, oldest first, filtered by status, username and creation time
 //	@Tags			orders
 //	@Accept			json
 //	@Produce		json
-//	@Success		200	{array}		model.Order
-//	@Failure		400	{object}	error
-//	@Failure		404	{object}	error
-//	@Failure		500	{object}	error
+//	@Param			status		query		[]string	false	"Order status"	collectionFormat(multi)	Enums(Submitting, Submitted, Cooking, Cooked, Delivering, Delivered, Cancelled)
+//	@Param			username	query		string		false	"Username of the customer"
+//	@Param			from		query		string		false	"Created at or after (RFC 3339)"
+//	@Param			to			query		string		false	"Created before (RFC 3339)"
+//	@Param			limit		query		int			false	"Items per page (at most 100)"
+//	@Param			cursor		query		string		false	"nextCursor of the previous page"
+//	@Param			total		query		bool		false	"Count the matching items"
+//	@Success		200			{object}	dto.Page{items=[]model.Order}
+//	@Failure		400			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
 //	@Router			/provider/orders [get]
 //	@Security		ApiKeyAuth
-func ListOrders(c *gin.Context) {
+func (h *OrderHandler) ListOrders(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	// HTTP request
+	var query dto.OrderQuery
+	err := c.ShouldBindQuery(&query)
+	if err != nil {
+		dto.NewResponse().
+			SetCode(http.StatusBadRequest).
+			SetText(http.StatusText(http.StatusBadRequest)).
+			SetData(err.Error()).
+			AbortWithStatusJSON(c)
+		return
+	}
+
 	// Business logic
-	result, err := service.ListOrders(ctx)
+	result, err := h.Service.ListOrders(ctx, query)
+	if errors.Is(err, service.ErrInvalidCursor) {
+		dto.NewResponse().
+			SetCode(http.StatusBadRequest).
+			SetText(http.StatusText(http.StatusBadRequest)).
+			SetError(dto.ErrCodeInvalidCursor).
+			SetData(err.Error()).
+			SendJSON(c)
+		return
+	}
 	if err != nil {
-		dto.Response.
+		dto.NewResponse().
 			SetCode(http.StatusInternalServerError).
 			SetText(http.StatusText(http.StatusInternalServerError)).
 			SetData(err.Error()).
@@ -85,36 +144,59 @@ func ListOrders(c *gin.Context) {
 	}
 
 	// HTTP response
-	dto.Response.
+	dto.NewResponse().
 		SetCode(http.StatusOK).
 		SetText(http.StatusText(http.StatusOK)).
 		SetData(result).
 		SendJSON(c)
 }
 
-//	@Summary		List all active orders
-//	@Description	Show all orders currently active by username
+//	@Summary		List my orders
+//	@Description	Show the orders of the authenticated customer a page at a time, oldest first; active orders are not delivered or cancelled yet
 //	@Tags			orders
 //	@Accept			json
 //	@Produce		json
-//	@Success		200			{array}		model.Order
-//	@Failure		400			{object}	error
-//	@Failure		404			{object}	error
-//	@Failure		500			{object}	error
-//	@Param			username	path		string	true	"Username"
-//	@Router			/customer/{username}/orders/active [get]
+//	@Param			state	query		string	false	"Which orders to show (default all)"	Enums(active, history, all)
+//	@Param			limit	query		int		false	"Items per page (at most 100)"
+//	@Param			cursor	query		string	false	"nextCursor of the previous page"
+//	@Param			total	query		bool	false	"Count the matching items"
+//	@Success		200		{object}	dto.Page{items=[]model.Order}
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/customer/orders [get]
+//	@Router			/customer/me/orders [get]
 //	@Security		ApiKeyAuth
-func ListOrdersActive(c *gin.Context) {
+func (h *OrderHandler) ListCustomerOrders(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	// HTTP request
-	username := c.Param("username")
+	username := middleware.Username(c)
+
+	var query dto.CustomerOrderQuery
+	err := c.ShouldBindQuery(&query)
+	if err != nil {
+		dto.NewResponse().
+			SetCode(http.StatusBadRequest).
+			SetText(http.StatusText(http.StatusBadRequest)).
+			SetData(err.Error()).
+			AbortWithStatusJSON(c)
+		return
+	}
 
 	// Business logic
-	result, err := service.ListOrdersActive(ctx, username)
+	result, err := h.Service.ListCustomerOrders(ctx, username, query)
+	if errors.Is(err, service.ErrInvalidCursor) {
+		dto.NewResponse().
+			SetCode(http.StatusBadRequest).
+			SetText(http.StatusText(http.StatusBadRequest)).
+			SetError(dto.ErrCodeInvalidCursor).
+			SetData(err.Error()).
+			SendJSON(c)
+		return
+	}
 	if err != nil {
-		dto.Response.
+		dto.NewResponse().
 			SetCode(http.StatusInternalServerError).
 			SetText(http.StatusText(http.StatusInternalServerError)).
 			SetData(err.Error()).
@@ -123,49 +205,36 @@ func ListOrdersActive(c *gin.Context) {
 	}
 
 	// HTTP response
-	dto.Response.
+	dto.NewResponse().
 		SetCode(http.StatusOK).
 		SetText(http.StatusText(http.StatusOK)).
 		SetData(result).
 		SendJSON(c)
 }
 
-//	@Summary		List all past orders
-//	@Description	Show all order history by username
+//	@Summary		List my orders in a state
+//	@Description	Show the active or past orders of the authenticated customer, like /customer/orders with the state given in the path
 //	@Tags			orders
 //	@Accept			json
 //	@Produce		json
-//	@Success		200			{array}		model.Order
-//	@Failure		400			{object}	error
-//	@Failure		404			{object}	error
-//	@Failure		500			{object}	error
-//	@Param			username	path		string	true	"Username"
-//	@Router			/customer/{username}/orders/history [get]
+//	@Param			limit	query		int		false	"Items per page (at most 100)"
+//	@Param			cursor	query		string	false	"nextCursor of the previous page"
+//	@Param			total	query		bool	false	"Count the matching items"
+//	@Success		200		{object}	dto.Page{items=[]model.Order}
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/customer/me/orders/active [get]
+//	@Router			/customer/me/orders/history [get]
 //	@Security		ApiKeyAuth
-func ListOrdersHistory(c *gin.Context) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	// HTTP request
-	username := c.Param("username")
-
-	// Business logic
-	result, err := service.ListOrdersHistory(ctx, username)
-	if err != nil {
-		dto.Response.
-			SetCode(http.StatusInternalServerError).
-			SetText(http.StatusText(http.StatusInternalServerError)).
-			SetData(err.Error()).
-			SendJSON(c)
-		return
+func (h *OrderHandler) ListCustomerOrdersState(state string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// The state in the path wins over any state in the query.
+		query := c.Request.URL.Query()
+		query.Set("state", state)
+		c.Request.URL.RawQuery = query.Encode()
+
+		h.ListCustomerOrders(c)
 	}
-
-	// HTTP response
-	dto.Response.
-		SetCode(http.StatusOK).
-		SetText(http.StatusText(http.StatusOK)).
-		SetData(result).
-		SendJSON(c)
 }
 
 //	@Summary		Get an order
@@ -175,12 +244,13 @@ func ListOrdersHistory(c *gin.Context) {
 //	@Produce		json
 //	@Success		200	{object}	model.Order
 //	@Failure		400	{object}	error
+//	@Failure		403	{object}	error
 //	@Failure		404	{object}	error
 //	@Failure		500	{object}	error
 //	@Param			id	path		string	true	"Order ID"
 //	@Router			/customer/orders/{id} [get]
 //	@Security		ApiKeyAuth
-func GetOrder(c *gin.Context) {
+func (h *OrderHandler) GetOrder(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -188,18 +258,13 @@ func GetOrder(c *gin.Context) {
 	orderID := c.Param("id")
 
 	// Business logic
-	result, err := service.GetOrder(ctx, orderID)
-	if err != nil {
-		dto.Response.
-			SetCode(http.StatusInternalServerError).
-			SetText(http.StatusText(http.StatusInternalServerError)).
-			SetData(err.Error()).
-			SendJSON(c)
+	result, ok := authorizeOrder(ctx, c, h.Service, orderID)
+	if !ok {
 		return
 	}
 
 	// HTTP response
-	dto.Response.
+	dto.NewResponse().
 		SetCode(http.StatusOK).
 		SetText(http.StatusText(http.StatusOK)).
 		SetData(result).
@@ -207,28 +272,32 @@ func GetOrder(c *gin.Context) {
 }
 
 //	@Summary		Get order status
-//	@Description	Show the current status of an order by order ID
+//	@Description	Show the current status of an order with its status timeline and the preparation and delivery durations in seconds
 //	@Tags			orders
 //	@Accept			json
 //	@Produce		json
-//	@Success		200	{string}	string
+//	@Success		200	{object}	model.OrderTimeline
 //	@Failure		400	{object}	error
+//	@Failure		403	{object}	error
 //	@Failure		404	{object}	error
 //	@Failure		500	{object}	error
 //	@Param			id	path		string	true	"Order ID"
 //	@Router			/customer/orders/{id}/status [get]
 //	@Security		ApiKeyAuth
-func GetOrderStatus(c *gin.Context) {
+func (h *OrderHandler) GetOrderStatus(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	// HTTP request
 	orderID := c.Param("id")
+	if _, ok := authorizeOrder(ctx, c, h.Service, orderID); !ok {
+		return
+	}
 
 	// Business logic
-	result, err := service.GetOrderStatus(ctx, orderID)
+	result, err := h.Service.GetOrderStatus(ctx, orderID)
 	if err != nil {
-		dto.Response.
+		dto.NewResponse().
 			SetCode(http.StatusInternalServerError).
 			SetText(http.StatusText(http.StatusInternalServerError)).
 			SetData(err.Error()).
@@ -237,7 +306,7 @@ func GetOrderStatus(c *gin.Context) {
 	}
 
 	// HTTP response
-	dto.Response.
+	dto.NewResponse().
 		SetCode(http.StatusOK).
 		SetText(http.StatusText(http.StatusOK)).
 		SetData(result).
@@ -245,7 +314,7 @@ func GetOrderStatus(c *gin.Context) {
 }
 
 //	@Summary		Update order status
-//	@Description	Modify order status
+//	@Description	Move an order to the next status. Customers may submit or cancel their own orders before cooking starts; providers advance orders from cooking to delivery.
 //	@Tags			orders
 //	@Accept			json
 //	@Produce		json
@@ -253,21 +322,30 @@ func GetOrderStatus(c *gin.Context) {
 //	@Param			order	body		dto.OrderUpdateStatus	true	"Updated order status"
 //	@Success		200		{object}	model.Order
 //	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
 //	@Failure		404		{object}	error
+//	@Failure		409		{object}	error
 //	@Failure		500		{object}	error
 //	@Router			/provider/orders/{id}/status [put]
+//	@Router			/customer/orders/{id}/status [put]
 //	@Security		ApiKeyAuth
-func UpdateOrderStatus(c *gin.Context) {
+func (h *OrderHandler) UpdateOrderStatus(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	// HTTP request
 	orderID := c.Param("id")
+	role := middleware.Role(c)
+	if role == "customer" {
+		if _, ok := authorizeOrder(ctx, c, h.Service, orderID); !ok {
+			return
+		}
+	}
 
 	var order dto.OrderUpdateStatus
 	err := c.BindJSON(&order)
 	if err != nil {
-		dto.Response.
+		dto.NewResponse().
 			SetCode(http.StatusBadRequest).
 			SetText(http.StatusText(http.StatusBadRequest)).
 			SetData(err.Error()).
@@ -276,9 +354,35 @@ func UpdateOrderStatus(c *gin.Context) {
 	}
 
 	// Business logic
-	result, err := service.UpdateOrderStatus(ctx, orderID, order)
+	result, err := h.Service.UpdateOrderStatus(ctx, orderID, role, middleware.Username(c), order)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		dto.NewResponse().
+			SetCode(http.StatusNotFound).
+			SetText(http.StatusText(http.StatusNotFound)).
+			SetData(err.Error()).
+			SendJSON(c)
+		return
+	}
+	if errors.Is(err, service.ErrTransitionNotPermitted) {
+		dto.NewResponse().
+			SetCode(http.StatusForbidden).
+			SetText(http.StatusText(http.StatusForbidden)).
+			SetError(dto.ErrCodeTransitionNotPermitted).
+			SetData(err.Error()).
+			SendJSON(c)
+		return
+	}
+	if errors.Is(err, service.ErrIllegalTransition) {
+		dto.NewResponse().
+			SetCode(http.StatusConflict).
+			SetText(http.StatusText(http.StatusConflict)).
+			SetError(dto.ErrCodeIllegalTransition).
+			SetData(err.Error()).
+			SendJSON(c)
+		return
+	}
 	if err != nil {
-		dto.Response.
+		dto.NewResponse().
 			SetCode(http.StatusInternalServerError).
 			SetText(http.StatusText(http.StatusInternalServerError)).
 			SetData(err.Error()).
@@ -287,7 +391,7 @@ func UpdateOrderStatus(c *gin.Context) {
 	}
 
 	// HTTP response
-	dto.Response.
+	dto.NewResponse().
 		SetCode(http.StatusOK).
 		SetText(http.StatusText(http.StatusOK)).
 		SetData(result).
@@ -303,21 +407,25 @@ func UpdateOrderStatus(c *gin.Context) {
 //	@Param			order	body		dto.OrderUpdateCart	true	"New items to order"
 //	@Success		200		{object}	model.Order
 //	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
 //	@Failure		404		{object}	error
 //	@Failure		500		{object}	error
 //	@Router			/customer/orders/{id}/cart [put]
 //	@Security		ApiKeyAuth
-func UpdateOrderItems(c *gin.Context) {
+func (h *OrderHandler) UpdateOrderItems(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	// HTTP request
 	orderID := c.Param("id")
+	if _, ok := authorizeOrder(ctx, c, h.Service, orderID); !ok {
+		return
+	}
 
 	var order dto.OrderUpdateCart
 	err := c.BindJSON(&order)
 	if err != nil {
-		dto.Response.
+		dto.NewResponse().
 			SetCode(http.StatusBadRequest).
 			SetText(http.StatusText(http.StatusBadRequest)).
 			SetData(err.Error()).
@@ -326,9 +434,19 @@ func UpdateOrderItems(c *gin.Context) {
 	}
 
 	// Business logic
-	result, err := service.UpdateOrderItems(ctx, orderID, order)
+	result, err := h.Service.UpdateOrderItems(ctx, orderID, order)
+	var cartErr *service.CartError
+	if errors.As(err, &cartErr) {
+		dto.NewResponse().
+			SetCode(http.StatusBadRequest).
+			SetText(http.StatusText(http.StatusBadRequest)).
+			SetError(dto.ErrCodeInvalidCart).
+			SetData(cartErr.Lines).
+			SendJSON(c)
+		return
+	}
 	if err != nil {
-		dto.Response.
+		dto.NewResponse().
 			SetCode(http.StatusInternalServerError).
 			SetText(http.StatusText(http.StatusInternalServerError)).
 			SetData(err.Error()).
@@ -337,7 +455,7 @@ func UpdateOrderItems(c *gin.Context) {
 	}
 
 	// HTTP response
-	dto.Response.
+	dto.NewResponse().
 		SetCode(http.StatusOK).
 		SetText(http.StatusText(http.StatusOK)).
 		SetData(result).
@@ -353,21 +471,25 @@ func UpdateOrderItems(c *gin.Context) {
 //	@Param			order	body		[]string	true	"Items to delete"
 //	@Success		200		{object}	model.Order
 //	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
 //	@Failure		404		{object}	error
 //	@Failure		500		{object}	error
 //	@Router			/customer/orders/{id}/cart [delete]
 //	@Security		ApiKeyAuth
-func DeleteOrderItems(c *gin.Context) {
+func (h *OrderHandler) DeleteOrderItems(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	// HTTP request
 	orderID := c.Param("id")
+	if _, ok := authorizeOrder(ctx, c, h.Service, orderID); !ok {
+		return
+	}
 
 	var products []string
 	err := c.BindJSON(&products)
 	if err != nil {
-		dto.Response.
+		dto.NewResponse().
 			SetCode(http.StatusBadRequest).
 			SetText(http.StatusText(http.StatusBadRequest)).
 			SetData(err.Error()).
@@ -376,9 +498,9 @@ func DeleteOrderItems(c *gin.Context) {
 	}
 
 	// Business logic
-	result, err := service.DeleteOrderItems(ctx, orderID, products)
+	result, err := h.Service.DeleteOrderItems(ctx, orderID, products)
 	if err != nil {
-		dto.Response.
+		dto.NewResponse().
 			SetCode(http.StatusInternalServerError).
 			SetText(http.StatusText(http.StatusInternalServerError)).
 			SetData(err.Error()).
@@ -387,9 +509,43 @@ func DeleteOrderItems(c *gin.Context) {
 	}
 
 	// HTTP response
-	dto.Response.
+	dto.NewResponse().
 		SetCode(http.StatusOK).
 		SetText(http.StatusText(http.StatusOK)).
 		SetData(result).
 		SendJSON(c)
 }
+
+// authorizeOrder loads an order and aborts with 404 or 403 unless it exists
+// and belongs to the authenticated user.
+func authorizeOrder(ctx context.Context, c *gin.Context, svc *service.Service, orderID string) (*model.Order, bool) {
+	order, err := svc.GetOrder(ctx, orderID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		dto.NewResponse().
+			SetCode(http.StatusNotFound).
+			SetText(http.StatusText(http.StatusNotFound)).
+			SetData(err.Error()).
+			AbortWithStatusJSON(c)
+		return nil, false
+	}
+	if err != nil {
+		dto.NewResponse().
+			SetCode(http.StatusInternalServerError).
+			SetText(http.StatusText(http.StatusInternalServerError)).
+			SetData(err.Error()).
+			AbortWithStatusJSON(c)
+		return nil, false
+	}
+
+	if order.User.Username != middleware.Username(c) {
+		dto.NewResponse().
+			SetCode(http.StatusForbidden).
+			SetText(http.StatusText(http.StatusForbidden)).
+			SetError(dto.ErrCodeNotOwner).
+			SetData(errNotOwner.Error()).
+			AbortWithStatusJSON(c)
+		return nil, false
+	}
+
+	return order, true
+}
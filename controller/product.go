@@ -2,15 +2,22 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
 
 	"oos/dto"
 	"oos/service"
 )
 
+// ProductHandler serves the catalog and its stock.
+type ProductHandler struct {
+	Service *service.Service
+}
+
 //	@Summary		Create a new product
 //	@Description	Add a product document to the products collection
 //	@Tags			products
@@ -23,7 +30,7 @@ import (
 //	@Failure		500		{object}	error
 //	@Router			/provider/products [post]
 //	@Security		ApiKeyAuth
-func CreateProduct(c *gin.Context) {
+func (h *ProductHandler) CreateProduct(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -31,7 +38,7 @@ func CreateProduct(c *gin.Context) {
 	var product dto.ProductCreate
 	err := c.BindJSON(&product)
 	if err != nil {
-		dto.Response.
+		dto.NewResponse().
 			SetCode(http.StatusBadRequest).
 			SetText(http.StatusText(http.StatusBadRequest)).
 			SetData(err.Error()).
@@ -40,9 +47,9 @@ func CreateProduct(c *gin.Context) {
 	}
 
 	// Business logic
-	result, err := service.CreateProduct(ctx, product)
+	result, err := h.Service.CreateProduct(ctx, product)
 	if err != nil {
-		dto.Response.
+		dto.NewResponse().
 			SetCode(http.StatusInternalServerError).
 			SetText(http.StatusText(http.StatusInternalServerError)).
 			SetData(err.Error()).
@@ -51,7 +58,7 @@ func CreateProduct(c *gin.Context) {
 	}
 
 	// HTTP response
-	dto.Response.
+	dto.NewResponse().
 		SetCode(http.StatusCreated).
 		SetText(http.StatusText(http.StatusCreated)).
 		SetData(result).
@@ -59,28 +66,52 @@ func CreateProduct(c *gin.Context) {
 }
 
 //	@Summary		List all products
-//	@Description	Show all products available to customers
+//	@Description	Show the products customers can see; ratings is the average rating, reorders counts orders after the first of each customer and time is the creation time
 //	@Tags			products
 //	@Accept			json
 //	@Produce		json
-//	@Param			sort	query		string	true	"Parameter used to sort products"	Enums(ratings, reorders, likes, time)
-//	@Success		200		{array}		model.ProductView
-//	@Failure		400		{object}	error
-//	@Failure		404		{object}	error
-//	@Failure		500		{object}	error
+//	@Param			sort		query		string	false	"Parameter used to sort products (default time)"	Enums(ratings, reorders, likes, time)
+//	@Param			then		query		string	false	"Parameter used to break ties"	Enums(ratings, reorders, likes, time)
+//	@Param			order		query		string	false	"Sort direction (default desc)"	Enums(asc, desc)
+//	@Param			orderable	query		bool	false	"Only products that can be ordered now"
+//	@Param			limit		query		int		false	"Items per page (at most 100)"
+//	@Param			cursor		query		string	false	"nextCursor of the previous page"
+//	@Param			total		query		bool	false	"Count the matching items"
+//	@Success		200			{object}	dto.Page{items=[]model.ProductView}
+//	@Failure		400			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
 //	@Router			/customer/products [get]
 //	@Security		ApiKeyAuth
-func ListProducts(c *gin.Context) {
+func (h *ProductHandler) ListProducts(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	// HTTP request
-	sortBy := c.Query("sort")
+	var query dto.ProductQuery
+	err := c.ShouldBindQuery(&query)
+	if err != nil {
+		dto.NewResponse().
+			SetCode(http.StatusBadRequest).
+			SetText(http.StatusText(http.StatusBadRequest)).
+			SetData(err.Error()).
+			AbortWithStatusJSON(c)
+		return
+	}
 
 	// Business logic
-	result, err := service.ListProducts(ctx, sortBy)
+	result, err := h.Service.ListProducts(ctx, query)
+	if errors.Is(err, service.ErrInvalidCursor) {
+		dto.NewResponse().
+			SetCode(http.StatusBadRequest).
+			SetText(http.StatusText(http.StatusBadRequest)).
+			SetError(dto.ErrCodeInvalidCursor).
+			SetData(err.Error()).
+			SendJSON(c)
+		return
+	}
 	if err != nil {
-		dto.Response.
+		dto.NewResponse().
 			SetCode(http.StatusInternalServerError).
 			SetText(http.StatusText(http.StatusInternalServerError)).
 			SetData(err.Error()).
@@ -89,7 +120,7 @@ func ListProducts(c *gin.Context) {
 	}
 
 	// HTTP response
-	dto.Response.
+	dto.NewResponse().
 		SetCode(http.StatusOK).
 		SetText(http.StatusText(http.StatusOK)).
 		SetData(result).
@@ -97,7 +128,7 @@ func ListProducts(c *gin.Context) {
 }
 
 //	@Summary		Get a product
-//	@Description	Show a product
+//	@Description	Show a product with its rating histogram
 //	@Tags			products
 //	@Accept			json
 //	@Produce		json
@@ -108,7 +139,7 @@ func ListProducts(c *gin.Context) {
 //	@Failure		500		{object}	error
 //	@Router			/customer/products/{code} [get]
 //	@Security		ApiKeyAuth
-func GetProduct(c *gin.Context) {
+func (h *ProductHandler) GetProduct(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -116,9 +147,17 @@ func GetProduct(c *gin.Context) {
 	productCode := c.Param("code")
 
 	// Business logic
-	result, err := service.GetProduct(ctx, productCode)
+	result, err := h.Service.GetProduct(ctx, productCode)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		dto.NewResponse().
+			SetCode(http.StatusNotFound).
+			SetText(http.StatusText(http.StatusNotFound)).
+			SetData(err.Error()).
+			SendJSON(c)
+		return
+	}
 	if err != nil {
-		dto.Response.
+		dto.NewResponse().
 			SetCode(http.StatusInternalServerError).
 			SetText(http.StatusText(http.StatusInternalServerError)).
 			SetData(err.Error()).
@@ -126,11 +165,21 @@ func GetProduct(c *gin.Context) {
 		return
 	}
 
+	// Customers cannot see hidden products.
+	if !result.CanView {
+		dto.NewResponse().
+			SetCode(http.StatusNotFound).
+			SetText(http.StatusText(http.StatusNotFound)).
+			SetData(mongo.ErrNoDocuments.Error()).
+			SendJSON(c)
+		return
+	}
+
 	// HTTP response
-	dto.Response.
+	dto.NewResponse().
 		SetCode(http.StatusOK).
 		SetText(http.StatusText(http.StatusOK)).
-		SetData(result).
+		SetData(result.ProductView).
 		SendJSON(c)
 }
 
@@ -147,7 +196,7 @@ func GetProduct(c *gin.Context) {
 //	@Failure		500		{object}	error
 //	@Router			/provider/products/{code} [put]
 //	@Security		ApiKeyAuth
-func UpdateProduct(c *gin.Context) {
+func (h *ProductHandler) UpdateProduct(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -157,7 +206,7 @@ func UpdateProduct(c *gin.Context) {
 	var product dto.ProductUpdate
 	err := c.BindJSON(&product)
 	if err != nil {
-		dto.Response.
+		dto.NewResponse().
 			SetCode(http.StatusBadRequest).
 			SetText(http.StatusText(http.StatusBadRequest)).
 			SetData(err.Error()).
@@ -166,9 +215,9 @@ func UpdateProduct(c *gin.Context) {
 	}
 
 	// Business logic
-	result, err := service.UpdateProduct(ctx, productCode, product)
+	result, err := h.Service.UpdateProduct(ctx, productCode, product)
 	if err != nil {
-		dto.Response.
+		dto.NewResponse().
 			SetCode(http.StatusInternalServerError).
 			SetText(http.StatusText(http.StatusInternalServerError)).
 			SetData(err.Error()).
@@ -177,7 +226,7 @@ func UpdateProduct(c *gin.Context) {
 	}
 
 	// HTTP response
-	dto.Response.
+	dto.NewResponse().
 		SetCode(http.StatusOK).
 		SetText(http.StatusText(http.StatusOK)).
 		SetData(result).
@@ -196,7 +245,7 @@ func UpdateProduct(c *gin.Context) {
 //	@Failure		500		{object}	error
 //	@Router			/provider/products/{code} [delete]
 //	@Security		ApiKeyAuth
-func DeleteProduct(c *gin.Context) {
+func (h *ProductHandler) DeleteProduct(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -204,9 +253,113 @@ func DeleteProduct(c *gin.Context) {
 	productCode := c.Param("code")
 
 	// Business logic
-	result, err := service.DeleteProduct(ctx, productCode)
+	result, err := h.Service.DeleteProduct(ctx, productCode)
+	if err != nil {
+		dto.NewResponse().
+			SetCode(http.StatusInternalServerError).
+			SetText(http.StatusText(http.StatusInternalServerError)).
+			SetData(err.Error()).
+			SendJSON(c)
+		return
+	}
+
+	// HTTP response
+	dto.NewResponse().
+		SetCode(http.StatusOK).
+		SetText(http.StatusText(http.StatusOK)).
+		SetData(result).
+		SendJSON(c)
+}
+
+//	@Summary		Get product stock
+//	@Description	Show the remaining stock of a product in the current period
+//	@Tags			products
+//	@Accept			json
+//	@Produce		json
+//	@Param			code	path		string	true	"Product code"
+//	@Success		200		{object}	model.ProductStock
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/provider/products/{code}/stock [get]
+//	@Security		ApiKeyAuth
+func (h *ProductHandler) GetStock(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// HTTP request
+	productCode := c.Param("code")
+
+	// Business logic
+	result, err := h.Service.GetStock(ctx, productCode)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		dto.NewResponse().
+			SetCode(http.StatusNotFound).
+			SetText(http.StatusText(http.StatusNotFound)).
+			SetData(err.Error()).
+			SendJSON(c)
+		return
+	}
+	if err != nil {
+		dto.NewResponse().
+			SetCode(http.StatusInternalServerError).
+			SetText(http.StatusText(http.StatusInternalServerError)).
+			SetData(err.Error()).
+			SendJSON(c)
+		return
+	}
+
+	// HTTP response
+	dto.NewResponse().
+		SetCode(http.StatusOK).
+		SetText(http.StatusText(http.StatusOK)).
+		SetData(result).
+		SendJSON(c)
+}
+
+//	@Summary		Update product stock
+//	@Description	Set the remaining stock of a product until the next reset; zero closes it as sold out
+//	@Tags			products
+//	@Accept			json
+//	@Produce		json
+//	@Param			code	path		string			true	"Product code"
+//	@Param			stock	body		dto.StockUpdate	true	"Remaining stock"
+//	@Success		200		{object}	model.ProductStock
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/provider/products/{code}/stock [put]
+//	@Security		ApiKeyAuth
+func (h *ProductHandler) UpdateStock(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// HTTP request
+	productCode := c.Param("code")
+
+	var stock dto.StockUpdate
+	err := c.BindJSON(&stock)
+	if err != nil {
+		dto.NewResponse().
+			SetCode(http.StatusBadRequest).
+			SetText(http.StatusText(http.StatusBadRequest)).
+			SetData(err.Error()).
+			AbortWithStatusJSON(c)
+		return
+	}
+
+	// Business logic
+	result, err := h.Service.UpdateStock(ctx, productCode, stock)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		dto.NewResponse().
+			SetCode(http.StatusNotFound).
+			SetText(http.StatusText(http.StatusNotFound)).
+			SetData(err.Error()).
+			SendJSON(c)
+		return
+	}
 	if err != nil {
-		dto.Response.
+		dto.NewResponse().
 			SetCode(http.StatusInternalServerError).
 			SetText(http.StatusText(http.StatusInternalServerError)).
 			SetData(err.Error()).
@@ -215,7 +368,7 @@ func DeleteProduct(c *gin.Context) {
 	}
 
 	// HTTP response
-	dto.Response.
+	dto.NewResponse().
 		SetCode(http.StatusOK).
 		SetText(http.StatusText(http.StatusOK)).
 		SetData(result).
@@ -2,17 +2,24 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
 
 	"oos/dto"
 	"oos/service"
 )
 
+// ReviewHandler serves reviews of orders and their products.
+type ReviewHandler struct {
+	Service *service.Service
+}
+
 //	@Summary		Create a new review
-//	@Description	Add a review document to the reviews collection
+//	@Description	Add a review document to the reviews collection; an order is reviewed once, after it is delivered, and only for products in its cart
 //	@Tags			reviews
 //	@Accept			json
 //	@Produce		json
@@ -20,21 +27,26 @@ import (
 //	@Param			review	body		dto.ReviewOrderCreate	true	"A new review to add"
 //	@Success		200		{object}	model.ReviewOrder
 //	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
 //	@Failure		404		{object}	error
+//	@Failure		409		{object}	error
 //	@Failure		500		{object}	error
 //	@Router			/customer/reviews/orders/{id} [post]
 //	@Security		ApiKeyAuth
-func CreateReview(c *gin.Context) {
+func (h *ReviewHandler) CreateReview(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	// HTTP request
 	orderID := c.Param("id")
+	if _, ok := authorizeOrder(ctx, c, h.Service, orderID); !ok {
+		return
+	}
 
 	var review dto.ReviewOrderCreate
 	err := c.BindJSON(&review)
 	if err != nil {
-		dto.Response.
+		dto.NewResponse().
 			SetCode(http.StatusBadRequest).
 			SetText(http.StatusText(http.StatusBadRequest)).
 			SetData(err.Error()).
@@ -43,9 +55,36 @@ func CreateReview(c *gin.Context) {
 	}
 
 	// Business logic
-	result, err := service.CreateReview(ctx, orderID, review)
+	result, err := h.Service.CreateReview(ctx, orderID, review)
+	if errors.Is(err, service.ErrReviewExists) {
+		dto.NewResponse().
+			SetCode(http.StatusConflict).
+			SetText(http.StatusText(http.StatusConflict)).
+			SetError(dto.ErrCodeReviewExists).
+			SetData(err.Error()).
+			SendJSON(c)
+		return
+	}
+	if errors.Is(err, service.ErrOrderNotDelivered) {
+		dto.NewResponse().
+			SetCode(http.StatusConflict).
+			SetText(http.StatusText(http.StatusConflict)).
+			SetError(dto.ErrCodeOrderNotDelivered).
+			SetData(err.Error()).
+			SendJSON(c)
+		return
+	}
+	if errors.Is(err, service.ErrProductNotInOrder) {
+		dto.NewResponse().
+			SetCode(http.StatusBadRequest).
+			SetText(http.StatusText(http.StatusBadRequest)).
+			SetError(dto.ErrCodeProductNotInOrder).
+			SetData(err.Error()).
+			SendJSON(c)
+		return
+	}
 	if err != nil {
-		dto.Response.
+		dto.NewResponse().
 			SetCode(http.StatusInternalServerError).
 			SetText(http.StatusText(http.StatusInternalServerError)).
 			SetData(err.Error()).
@@ -54,32 +93,119 @@ func CreateReview(c *gin.Context) {
 	}
 
 	// HTTP response
-	dto.Response.
+	dto.NewResponse().
 		SetCode(http.StatusCreated).
 		SetText(http.StatusText(http.StatusCreated)).
 		SetData(result).
 		SendJSON(c)
 }
 
-//	@Summary		List all reviews
-//	@Description	Show all reviews
+//	@Summary		Update a review
+//	@Description	Replace the rating, comments and likes of a review and correct the product aggregates
+//	@Tags			reviews
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		string					true	"Order ID"
+//	@Param			review	body		dto.ReviewOrderCreate	true	"The review to replace it with"
+//	@Success		200		{object}	model.ReviewOrder
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/customer/reviews/orders/{id} [put]
+//	@Security		ApiKeyAuth
+func (h *ReviewHandler) UpdateReview(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// HTTP request
+	orderID := c.Param("id")
+	if _, ok := authorizeOrder(ctx, c, h.Service, orderID); !ok {
+		return
+	}
+
+	var review dto.ReviewOrderCreate
+	err := c.BindJSON(&review)
+	if err != nil {
+		dto.NewResponse().
+			SetCode(http.StatusBadRequest).
+			SetText(http.StatusText(http.StatusBadRequest)).
+			SetData(err.Error()).
+			AbortWithStatusJSON(c)
+		return
+	}
+
+	// Business logic
+	result, err := h.Service.UpdateReview(ctx, orderID, review)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		dto.NewResponse().
+			SetCode(http.StatusNotFound).
+			SetText(http.StatusText(http.StatusNotFound)).
+			SetData(err.Error()).
+			SendJSON(c)
+		return
+	}
+	if errors.Is(err, service.ErrProductNotInOrder) {
+		dto.NewResponse().
+			SetCode(http.StatusBadRequest).
+			SetText(http.StatusText(http.StatusBadRequest)).
+			SetError(dto.ErrCodeProductNotInOrder).
+			SetData(err.Error()).
+			SendJSON(c)
+		return
+	}
+	if err != nil {
+		dto.NewResponse().
+			SetCode(http.StatusInternalServerError).
+			SetText(http.StatusText(http.StatusInternalServerError)).
+			SetData(err.Error()).
+			SendJSON(c)
+		return
+	}
+
+	// HTTP response
+	dto.NewResponse().
+		SetCode(http.StatusOK).
+		SetText(http.StatusText(http.StatusOK)).
+		SetData(result).
+		SendJSON(c)
+}
+
+//	@Summary		Delete a review
+//	@Description	Remove a review and take it out of the product aggregates
 //	@Tags			reviews
 //	@Accept			json
 //	@Produce		json
-//	@Success		200	{array}		model.ReviewOrder
+//	@Param			id	path		string	true	"Order ID"
+//	@Success		200	{object}	model.ReviewOrder
 //	@Failure		400	{object}	error
+//	@Failure		403	{object}	error
 //	@Failure		404	{object}	error
 //	@Failure		500	{object}	error
-//	@Router			/provider/reviews/orders [get]
+//	@Router			/customer/reviews/orders/{id} [delete]
 //	@Security		ApiKeyAuth
-func ListReviews(c *gin.Context) {
+func (h *ReviewHandler) DeleteReview(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	// HTTP request
+	orderID := c.Param("id")
+	if _, ok := authorizeOrder(ctx, c, h.Service, orderID); !ok {
+		return
+	}
+
 	// Business logic
-	result, err := service.ListReviews(ctx)
+	result, err := h.Service.DeleteReview(ctx, orderID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		dto.NewResponse().
+			SetCode(http.StatusNotFound).
+			SetText(http.StatusText(http.StatusNotFound)).
+			SetData(err.Error()).
+			SendJSON(c)
+		return
+	}
 	if err != nil {
-		dto.Response.
+		dto.NewResponse().
 			SetCode(http.StatusInternalServerError).
 			SetText(http.StatusText(http.StatusInternalServerError)).
 			SetData(err.Error()).
@@ -88,36 +214,177 @@ func ListReviews(c *gin.Context) {
 	}
 
 	// HTTP response
-	dto.Response.
+	dto.NewResponse().
 		SetCode(http.StatusOK).
 		SetText(http.StatusText(http.StatusOK)).
 		SetData(result).
 		SendJSON(c)
 }
 
-//	@Summary		List all reviews of a product
-//	@Description	Show all reviews of a product
+//	@Summary		Hide or unhide a review
+//	@Description	Moderate a review; hidden reviews are not listed to customers or counted in the product aggregates
 //	@Tags			reviews
 //	@Accept			json
 //	@Produce		json
-//	@Param			code	path		string	true	"Product code"
-//	@Success		200		{array}		model.ReviewProduct
+//	@Param			id		path		string					true	"Order ID"
+//	@Param			hidden	body		dto.ReviewUpdateHidden	true	"Whether to hide the review"
+//	@Success		200		{object}	model.ReviewOrder
 //	@Failure		400		{object}	error
 //	@Failure		404		{object}	error
 //	@Failure		500		{object}	error
+//	@Router			/provider/reviews/orders/{id}/hidden [put]
+//	@Security		ApiKeyAuth
+func (h *ReviewHandler) HideReview(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// HTTP request
+	orderID := c.Param("id")
+
+	var hidden dto.ReviewUpdateHidden
+	err := c.BindJSON(&hidden)
+	if err != nil {
+		dto.NewResponse().
+			SetCode(http.StatusBadRequest).
+			SetText(http.StatusText(http.StatusBadRequest)).
+			SetData(err.Error()).
+			AbortWithStatusJSON(c)
+		return
+	}
+
+	// Business logic
+	result, err := h.Service.HideReview(ctx, orderID, hidden)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		dto.NewResponse().
+			SetCode(http.StatusNotFound).
+			SetText(http.StatusText(http.StatusNotFound)).
+			SetData(err.Error()).
+			SendJSON(c)
+		return
+	}
+	if err != nil {
+		dto.NewResponse().
+			SetCode(http.StatusInternalServerError).
+			SetText(http.StatusText(http.StatusInternalServerError)).
+			SetData(err.Error()).
+			SendJSON(c)
+		return
+	}
+
+	// HTTP response
+	dto.NewResponse().
+		SetCode(http.StatusOK).
+		SetText(http.StatusText(http.StatusOK)).
+		SetData(result).
+		SendJSON(c)
+}
+
+//	@Summary		List all reviews
+//	@Description	Show all reviews
+//	@Tags			reviews
+//	@Accept			json
+//	@Produce		json
+//	@Param			limit	query		int		false	"Items per page (at most 100)"
+//	@Param			cursor	query		string	false	"nextCursor of the previous page"
+//	@Param			total	query		bool	false	"Count the matching items"
+//	@Success		200		{object}	dto.Page{items=[]model.ReviewOrder}
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/provider/reviews/orders [get]
+//	@Security		ApiKeyAuth
+func (h *ReviewHandler) ListReviews(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// HTTP request
+	var query dto.PageQuery
+	err := c.ShouldBindQuery(&query)
+	if err != nil {
+		dto.NewResponse().
+			SetCode(http.StatusBadRequest).
+			SetText(http.StatusText(http.StatusBadRequest)).
+			SetData(err.Error()).
+			AbortWithStatusJSON(c)
+		return
+	}
+
+	// Business logic
+	result, err := h.Service.ListReviews(ctx, query)
+	if errors.Is(err, service.ErrInvalidCursor) {
+		dto.NewResponse().
+			SetCode(http.StatusBadRequest).
+			SetText(http.StatusText(http.StatusBadRequest)).
+			SetError(dto.ErrCodeInvalidCursor).
+			SetData(err.Error()).
+			SendJSON(c)
+		return
+	}
+	if err != nil {
+		dto.NewResponse().
+			SetCode(http.StatusInternalServerError).
+			SetText(http.StatusText(http.StatusInternalServerError)).
+			SetData(err.Error()).
+			SendJSON(c)
+		return
+	}
+
+	// HTTP response
+	dto.NewResponse().
+		SetCode(http.StatusOK).
+		SetText(http.StatusText(http.StatusOK)).
+		SetData(result).
+		SendJSON(c)
+}
+
+//	@Summary		List all reviews of a product
+//	@Description	Show the visible reviews of a product a page at a time
+//	@Tags			reviews
+//	@Accept			json
+//	@Produce		json
+//	@Param			code		path		string	true	"Product code"
+//	@Param			sort		query		string	false	"Sort order"	Enums(newest, highest, lowest)
+//	@Param			withComment	query		bool	false	"Only reviews with a comment on the product"
+//	@Param			limit		query		int		false	"Items per page (at most 100)"
+//	@Param			cursor		query		string	false	"nextCursor of the previous page"
+//	@Param			total		query		bool	false	"Count the matching items"
+//	@Success		200			{object}	dto.Page{items=[]model.ReviewView}
+//	@Failure		400			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
 //	@Router			/customer/reviews/products/{code} [get]
 //	@Security		ApiKeyAuth
-func ListReviewsProduct(c *gin.Context) {
+func (h *ReviewHandler) ListReviewsProduct(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	// HTTP request
 	productCode := c.Param("code")
 
+	var query dto.ReviewQuery
+	err := c.ShouldBindQuery(&query)
+	if err != nil {
+		dto.NewResponse().
+			SetCode(http.StatusBadRequest).
+			SetText(http.StatusText(http.StatusBadRequest)).
+			SetData(err.Error()).
+			AbortWithStatusJSON(c)
+		return
+	}
+
 	// Business logic
-	result, err := service.ListReviewsProduct(ctx, productCode)
+	result, err := h.Service.ListReviewsProduct(ctx, productCode, query)
+	if errors.Is(err, service.ErrInvalidCursor) {
+		dto.NewResponse().
+			SetCode(http.StatusBadRequest).
+			SetText(http.StatusText(http.StatusBadRequest)).
+			SetError(dto.ErrCodeInvalidCursor).
+			SetData(err.Error()).
+			SendJSON(c)
+		return
+	}
 	if err != nil {
-		dto.Response.
+		dto.NewResponse().
 			SetCode(http.StatusInternalServerError).
 			SetText(http.StatusText(http.StatusInternalServerError)).
 			SetData(err.Error()).
@@ -126,7 +393,7 @@ func ListReviewsProduct(c *gin.Context) {
 	}
 
 	// HTTP response
-	dto.Response.
+	dto.NewResponse().
 		SetCode(http.StatusOK).
 		SetText(http.StatusText(http.StatusOK)).
 		SetData(result).
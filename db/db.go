@@ -4,63 +4,40 @@ import (
 	"context"
 	"time"
 
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"oos/config"
 )
 
-var DB *mongo.Client
-
-var ProductCollection *mongo.Collection
-var OrderCollection *mongo.Collection
-var ReviewCollection *mongo.Collection
-
-func ConnectDB(cfg *config.Config) {
+// Connect connects to the MongoDB server set in cfg and returns its database.
+func Connect(cfg *config.Config) (*mongo.Database, error) {
 	cf := cfg.DB
-	uri := cf["host"]
-	databaseName := cf["name"]
-
-	DB = getDatabase(uri)
-
-	ProductCollection = GetCollection(DB, databaseName, "products")
-	OrderCollection = GetCollection(DB, databaseName, "orders")
-	ReviewCollection = GetCollection(DB, databaseName, "reviews")
-
-	// Product codes should be unique.
-	_, err := ProductCollection.Indexes().CreateOne(
-		context.Background(),
-		mongo.IndexModel{
-			Keys:    bson.D{{Key: "productquery.productcreate.code", Value: 1}},
-			Options: options.Index().SetUnique(true),
-		},
-	)
+	client, err := getClient(cf.Host)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
+
+	return client.Database(cf.Name), nil
 }
 
-func getDatabase(uri string) *mongo.Client {
+func getClient(uri string) (*mongo.Client, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	client, err := mongo.NewClient(options.Client().ApplyURI(uri))
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	if err = client.Connect(ctx); err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	if err = client.Ping(ctx, nil); err != nil {
-		panic(err)
+		client.Disconnect(ctx)
+		return nil, err
 	}
 
-	return client
-}
-
-func GetCollection(client *mongo.Client, databaseName string, collectionName string) *mongo.Collection {
-	return client.Database(databaseName).Collection(collectionName)
+	return client, nil
 }
@@ -20,9 +20,29 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/account/jwks.json": {
+            "get": {
+                "description": "Public keys that verify tokens issued by this server, selected by the kid header (empty for HS256)",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "accounts"
+                ],
+                "summary": "JSON Web Key Set",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object"
+                        }
+                    }
+                }
+            }
+        },
         "/account/login/{role}": {
             "post": {
-                "description": "Authenticate to get access token",
+                "description": "Authenticate with username and password to get an access token for a role the user holds",
                 "consumes": [
                     "application/json"
                 ],
@@ -44,6 +64,15 @@ const docTemplate = `{
                         "name": "role",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "description": "Username and password",
+                        "name": "credentials",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.AccountLogin"
+                        }
                     }
                 ],
                 "responses": {
@@ -57,8 +86,378 @@ const docTemplate = `{
                         "description": "Bad Request",
                         "schema": {}
                     },
-                    "404": {
-                        "description": "Not Found",
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {}
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {}
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {}
+                    }
+                }
+            }
+        },
+        "/account/logout": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Revoke the current access token and, if given, the refresh token issued with it",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "accounts"
+                ],
+                "summary": "Logout",
+                "parameters": [
+                    {
+                        "description": "Refresh token",
+                        "name": "token",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/dto.TokenRefresh"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/dto.HTTPResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {}
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {}
+                    }
+                }
+            }
+        },
+        "/account/refresh": {
+            "post": {
+                "description": "Exchange a refresh token for a new access token and refresh token; the old refresh token is revoked",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "accounts"
+                ],
+                "summary": "Refresh tokens",
+                "parameters": [
+                    {
+                        "description": "Refresh token",
+                        "name": "token",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.TokenRefresh"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/model.Token"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {}
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {}
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {}
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {}
+                    }
+                }
+            }
+        },
+        "/account/register": {
+            "post": {
+                "description": "Add a user document with a hashed password to the users collection",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "accounts"
+                ],
+                "summary": "Register a new account",
+                "parameters": [
+                    {
+                        "description": "A new account to register",
+                        "name": "account",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.AccountCreate"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/model.User"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {}
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {}
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {}
+                    }
+                }
+            }
+        },
+        "/customer/me/orders": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Show the orders of the authenticated customer a page at a time, oldest first; active orders are not delivered or cancelled yet",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "orders"
+                ],
+                "summary": "List my orders",
+                "parameters": [
+                    {
+                        "enum": [
+                            "active",
+                            "history",
+                            "all"
+                        ],
+                        "type": "string",
+                        "description": "Which orders to show (default all)",
+                        "name": "state",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Items per page (at most 100)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "nextCursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Count the matching items",
+                        "name": "total",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/dto.Page"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "items": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/model.Order"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {}
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {}
+                    }
+                }
+            }
+        },
+        "/customer/me/orders/active": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Show the active or past orders of the authenticated customer, like /customer/orders with the state given in the path",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "orders"
+                ],
+                "summary": "List my orders in a state",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Items per page (at most 100)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "nextCursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Count the matching items",
+                        "name": "total",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/dto.Page"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "items": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/model.Order"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {}
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {}
+                    }
+                }
+            }
+        },
+        "/customer/me/orders/history": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Show the active or past orders of the authenticated customer, like /customer/orders with the state given in the path",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "orders"
+                ],
+                "summary": "List my orders in a state",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Items per page (at most 100)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "nextCursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Count the matching items",
+                        "name": "total",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/dto.Page"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "items": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/model.Order"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
                         "schema": {}
                     },
                     "500": {
@@ -69,6 +468,86 @@ const docTemplate = `{
             }
         },
         "/customer/orders": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Show the orders of the authenticated customer a page at a time, oldest first; active orders are not delivered or cancelled yet",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "orders"
+                ],
+                "summary": "List my orders",
+                "parameters": [
+                    {
+                        "enum": [
+                            "active",
+                            "history",
+                            "all"
+                        ],
+                        "type": "string",
+                        "description": "Which orders to show (default all)",
+                        "name": "state",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Items per page (at most 100)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "nextCursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Count the matching items",
+                        "name": "total",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/dto.Page"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "items": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/model.Order"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {}
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {}
+                    }
+                }
+            },
             "post": {
                 "security": [
                     {
@@ -108,6 +587,10 @@ const docTemplate = `{
                         "description": "Bad Request",
                         "schema": {}
                     },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {}
+                    },
                     "404": {
                         "description": "Not Found",
                         "schema": {}
@@ -157,6 +640,10 @@ const docTemplate = `{
                         "description": "Bad Request",
                         "schema": {}
                     },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {}
+                    },
                     "404": {
                         "description": "Not Found",
                         "schema": {}
@@ -215,6 +702,10 @@ const docTemplate = `{
                         "description": "Bad Request",
                         "schema": {}
                     },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {}
+                    },
                     "404": {
                         "description": "Not Found",
                         "schema": {}
@@ -274,6 +765,10 @@ const docTemplate = `{
                         "description": "Bad Request",
                         "schema": {}
                     },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {}
+                    },
                     "404": {
                         "description": "Not Found",
                         "schema": {}
@@ -292,7 +787,7 @@ const docTemplate = `{
                         "ApiKeyAuth": []
                     }
                 ],
-                "description": "Show the current status of an order by order ID",
+                "description": "Show the current status of an order with its status timeline and the preparation and delivery durations in seconds",
                 "consumes": [
                     "application/json"
                 ],
@@ -316,13 +811,17 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/model.OrderTimeline"
                         }
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {}
                     },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {}
+                    },
                     "404": {
                         "description": "Not Found",
                         "schema": {}
@@ -332,6 +831,70 @@ const docTemplate = `{
                         "schema": {}
                     }
                 }
+            },
+            "put": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Move an order to the next status. Customers may submit or cancel their own orders before cooking starts; providers advance orders from cooking to delivery.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "orders"
+                ],
+                "summary": "Update order status",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Order ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Updated order status",
+                        "name": "order",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.OrderUpdateStatus"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/model.Order"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {}
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {}
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {}
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {}
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {}
+                    }
+                }
             }
         },
         "/customer/products": {
@@ -341,7 +904,7 @@ const docTemplate = `{
                         "ApiKeyAuth": []
                     }
                 ],
-                "description": "Show all products available to customers",
+                "description": "Show the products customers can see; ratings is the average rating, reorders counts orders after the first of each customer and time is the creation time",
                 "consumes": [
                     "application/json"
                 ],
@@ -361,20 +924,77 @@ const docTemplate = `{
                             "time"
                         ],
                         "type": "string",
-                        "description": "Parameter used to sort products",
+                        "description": "Parameter used to sort products (default time)",
                         "name": "sort",
-                        "in": "query",
-                        "required": true
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "ratings",
+                            "reorders",
+                            "likes",
+                            "time"
+                        ],
+                        "type": "string",
+                        "description": "Parameter used to break ties",
+                        "name": "then",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "asc",
+                            "desc"
+                        ],
+                        "type": "string",
+                        "description": "Sort direction (default desc)",
+                        "name": "order",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Only products that can be ordered now",
+                        "name": "orderable",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Items per page (at most 100)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "nextCursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Count the matching items",
+                        "name": "total",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/model.ProductView"
-                            }
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/dto.Page"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "items": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/model.ProductView"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
                         }
                     },
                     "400": {
@@ -399,7 +1019,7 @@ const docTemplate = `{
                         "ApiKeyAuth": []
                     }
                 ],
-                "description": "Show a product",
+                "description": "Show a product with its rating histogram",
                 "consumes": [
                     "application/json"
                 ],
@@ -423,13 +1043,75 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/model.ProductView"
+                            "$ref": "#/definitions/model.ProductView"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {}
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {}
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {}
+                    }
+                }
+            }
+        },
+        "/customer/reviews/orders/{id}": {
+            "put": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Replace the rating, comments and likes of a review and correct the product aggregates",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "reviews"
+                ],
+                "summary": "Update a review",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Order ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "The review to replace it with",
+                        "name": "review",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.ReviewOrderCreate"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/model.ReviewOrder"
                         }
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {}
                     },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {}
+                    },
                     "404": {
                         "description": "Not Found",
                         "schema": {}
@@ -439,16 +1121,14 @@ const docTemplate = `{
                         "schema": {}
                     }
                 }
-            }
-        },
-        "/customer/reviews/orders/{id}": {
+            },
             "post": {
                 "security": [
                     {
                         "ApiKeyAuth": []
                     }
                 ],
-                "description": "Add a review document to the reviews collection",
+                "description": "Add a review document to the reviews collection; an order is reviewed once, after it is delivered, and only for products in its cart",
                 "consumes": [
                     "application/json"
                 ],
@@ -488,25 +1168,31 @@ const docTemplate = `{
                         "description": "Bad Request",
                         "schema": {}
                     },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {}
+                    },
                     "404": {
                         "description": "Not Found",
                         "schema": {}
                     },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {}
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {}
                     }
                 }
-            }
-        },
-        "/customer/reviews/products/{code}": {
-            "get": {
+            },
+            "delete": {
                 "security": [
                     {
                         "ApiKeyAuth": []
                     }
                 ],
-                "description": "Show all reviews of a product",
+                "description": "Remove a review and take it out of the product aggregates",
                 "consumes": [
                     "application/json"
                 ],
@@ -516,12 +1202,12 @@ const docTemplate = `{
                 "tags": [
                     "reviews"
                 ],
-                "summary": "List all reviews of a product",
+                "summary": "Delete a review",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Product code",
-                        "name": "code",
+                        "description": "Order ID",
+                        "name": "id",
                         "in": "path",
                         "required": true
                     }
@@ -530,16 +1216,17 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/model.ReviewProduct"
-                            }
+                            "$ref": "#/definitions/model.ReviewOrder"
                         }
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {}
                     },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {}
+                    },
                     "404": {
                         "description": "Not Found",
                         "schema": {}
@@ -551,14 +1238,14 @@ const docTemplate = `{
                 }
             }
         },
-        "/customer/{username}/orders/active": {
+        "/customer/reviews/products/{code}": {
             "get": {
                 "security": [
                     {
                         "ApiKeyAuth": []
                     }
                 ],
-                "description": "Show all orders currently active by username",
+                "description": "Show the visible reviews of a product a page at a time",
                 "consumes": [
                     "application/json"
                 ],
@@ -566,26 +1253,73 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "orders"
+                    "reviews"
                 ],
-                "summary": "List all active orders",
+                "summary": "List all reviews of a product",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Username",
-                        "name": "username",
+                        "description": "Product code",
+                        "name": "code",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "enum": [
+                            "newest",
+                            "highest",
+                            "lowest"
+                        ],
+                        "type": "string",
+                        "description": "Sort order",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Only reviews with a comment on the product",
+                        "name": "withComment",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Items per page (at most 100)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "nextCursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Count the matching items",
+                        "name": "total",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/model.Order"
-                            }
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/dto.Page"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "items": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/model.ReviewView"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
                         }
                     },
                     "400": {
@@ -603,14 +1337,14 @@ const docTemplate = `{
                 }
             }
         },
-        "/customer/{username}/orders/history": {
-            "get": {
+        "/provider/accounts/{username}/roles": {
+            "put": {
                 "security": [
                     {
                         "ApiKeyAuth": []
                     }
                 ],
-                "description": "Show all order history by username",
+                "description": "Add a role to a registered user, e.g. to make a new provider",
                 "consumes": [
                     "application/json"
                 ],
@@ -618,9 +1352,9 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "orders"
+                    "accounts"
                 ],
-                "summary": "List all past orders",
+                "summary": "Grant a role",
                 "parameters": [
                     {
                         "type": "string",
@@ -628,16 +1362,22 @@ const docTemplate = `{
                         "name": "username",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "description": "Role to grant",
+                        "name": "role",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.RoleGrant"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/model.Order"
-                            }
+                            "$ref": "#/definitions/dto.HTTPResponse"
                         }
                     },
                     "400": {
@@ -662,7 +1402,7 @@ const docTemplate = `{
                         "ApiKeyAuth": []
                     }
                 ],
-                "description": "Show all orders",
+                "description": "Show orders a page at a time, oldest first, filtered by status, username and creation time",
                 "consumes": [
                     "application/json"
                 ],
@@ -673,14 +1413,83 @@ const docTemplate = `{
                     "orders"
                 ],
                 "summary": "List all orders",
+                "parameters": [
+                    {
+                        "type": "array",
+                        "items": {
+                            "enum": [
+                                "Submitting",
+                                "Submitted",
+                                "Cooking",
+                                "Cooked",
+                                "Delivering",
+                                "Delivered",
+                                "Cancelled"
+                            ],
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "Order status",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Username of the customer",
+                        "name": "username",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Created at or after (RFC 3339)",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Created before (RFC 3339)",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Items per page (at most 100)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "nextCursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Count the matching items",
+                        "name": "total",
+                        "in": "query"
+                    }
+                ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/model.Order"
-                            }
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/dto.Page"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "items": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/model.Order"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
                         }
                     },
                     "400": {
@@ -705,7 +1514,7 @@ const docTemplate = `{
                         "ApiKeyAuth": []
                     }
                 ],
-                "description": "Modify order status",
+                "description": "Move an order to the next status. Customers may submit or cancel their own orders before cooking starts; providers advance orders from cooking to delivery.",
                 "consumes": [
                     "application/json"
                 ],
@@ -745,10 +1554,18 @@ const docTemplate = `{
                         "description": "Bad Request",
                         "schema": {}
                     },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {}
+                    },
                     "404": {
                         "description": "Not Found",
                         "schema": {}
                     },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {}
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {}
@@ -912,6 +1729,111 @@ const docTemplate = `{
                 }
             }
         },
+        "/provider/products/{code}/stock": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Show the remaining stock of a product in the current period",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "products"
+                ],
+                "summary": "Get product stock",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Product code",
+                        "name": "code",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/model.ProductStock"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {}
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {}
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {}
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Set the remaining stock of a product until the next reset; zero closes it as sold out",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "products"
+                ],
+                "summary": "Update product stock",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Product code",
+                        "name": "code",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Remaining stock",
+                        "name": "stock",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.StockUpdate"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/model.ProductStock"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {}
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {}
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {}
+                    }
+                }
+            }
+        },
         "/provider/reviews/orders": {
             "get": {
                 "security": [
@@ -929,15 +1851,105 @@ const docTemplate = `{
                 "tags": [
                     "reviews"
                 ],
-                "summary": "List all reviews",
+                "summary": "List all reviews",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Items per page (at most 100)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "nextCursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Count the matching items",
+                        "name": "total",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/dto.Page"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "items": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/model.ReviewOrder"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {}
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {}
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {}
+                    }
+                }
+            }
+        },
+        "/provider/reviews/orders/{id}/hidden": {
+            "put": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Moderate a review; hidden reviews are not listed to customers or counted in the product aggregates",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "reviews"
+                ],
+                "summary": "Hide or unhide a review",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Order ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Whether to hide the review",
+                        "name": "hidden",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.ReviewUpdateHidden"
+                        }
+                    }
+                ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/model.ReviewOrder"
-                            }
+                            "$ref": "#/definitions/model.ReviewOrder"
                         }
                     },
                     "400": {
@@ -957,6 +1969,59 @@ const docTemplate = `{
         }
     },
     "definitions": {
+        "dto.AccountCreate": {
+            "type": "object",
+            "required": [
+                "address",
+                "email",
+                "password",
+                "phone",
+                "username"
+            ],
+            "properties": {
+                "address": {
+                    "$ref": "#/definitions/dto.AddressCreate"
+                },
+                "email": {
+                    "type": "string",
+                    "example": "abc1@gmail.com"
+                },
+                "password": {
+                    "type": "string",
+                    "maxLength": 72,
+                    "minLength": 8,
+                    "example": "password1234"
+                },
+                "phone": {
+                    "type": "string",
+                    "example": "+821011112222"
+                },
+                "username": {
+                    "type": "string",
+                    "maxLength": 30,
+                    "example": "abc1"
+                }
+            }
+        },
+        "dto.AccountLogin": {
+            "type": "object",
+            "required": [
+                "password",
+                "username"
+            ],
+            "properties": {
+                "password": {
+                    "type": "string",
+                    "maxLength": 72,
+                    "example": "password1234"
+                },
+                "username": {
+                    "type": "string",
+                    "maxLength": 30,
+                    "example": "abc1"
+                }
+            }
+        },
         "dto.AddressCreate": {
             "type": "object",
             "required": [
@@ -993,6 +2058,21 @@ const docTemplate = `{
                 }
             }
         },
+        "dto.HTTPResponse": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "integer"
+                },
+                "data": {},
+                "error": {
+                    "type": "string"
+                },
+                "text": {
+                    "type": "string"
+                }
+            }
+        },
         "dto.OrderCreate": {
             "type": "object",
             "required": [
@@ -1039,6 +2119,11 @@ const docTemplate = `{
                 "status"
             ],
             "properties": {
+                "note": {
+                    "type": "string",
+                    "maxLength": 200,
+                    "example": "Extra napkins"
+                },
                 "status": {
                     "type": "string",
                     "enum": [
@@ -1053,6 +2138,18 @@ const docTemplate = `{
                 }
             }
         },
+        "dto.Page": {
+            "type": "object",
+            "properties": {
+                "items": {},
+                "nextCursor": {
+                    "type": "string"
+                },
+                "total": {
+                    "type": "integer"
+                }
+            }
+        },
         "dto.ProductCreate": {
             "type": "object",
             "required": [
@@ -1150,6 +2247,7 @@ const docTemplate = `{
                 },
                 "reviewProducts": {
                     "type": "array",
+                    "uniqueItems": true,
                     "items": {
                         "$ref": "#/definitions/dto.ReviewProductCreate"
                     }
@@ -1174,6 +2272,59 @@ const docTemplate = `{
                 "productCode": {
                     "type": "string",
                     "example": "bc01"
+                },
+                "rating": {
+                    "type": "integer",
+                    "maximum": 5,
+                    "minimum": 1,
+                    "example": 5
+                }
+            }
+        },
+        "dto.ReviewUpdateHidden": {
+            "type": "object",
+            "properties": {
+                "hidden": {
+                    "type": "boolean",
+                    "example": true
+                }
+            }
+        },
+        "dto.RoleGrant": {
+            "type": "object",
+            "required": [
+                "role"
+            ],
+            "properties": {
+                "role": {
+                    "type": "string",
+                    "enum": [
+                        "customer",
+                        "provider"
+                    ],
+                    "example": "provider"
+                }
+            }
+        },
+        "dto.StockUpdate": {
+            "type": "object",
+            "properties": {
+                "stock": {
+                    "type": "integer",
+                    "minimum": 0,
+                    "example": 20
+                }
+            }
+        },
+        "dto.TokenRefresh": {
+            "type": "object",
+            "required": [
+                "refreshToken"
+            ],
+            "properties": {
+                "refreshToken": {
+                    "type": "string",
+                    "example": "eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."
                 }
             }
         },
@@ -1224,9 +2375,18 @@ const docTemplate = `{
                 "createdAt": {
                     "type": "integer"
                 },
+                "deliveryFee": {
+                    "type": "number"
+                },
                 "id": {
                     "type": "string"
                 },
+                "items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.OrderItem"
+                    }
+                },
                 "status": {
                     "type": "string",
                     "enum": [
@@ -1239,6 +2399,21 @@ const docTemplate = `{
                         "Cancelled"
                     ]
                 },
+                "statusHistory": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.OrderStatusChange"
+                    }
+                },
+                "subtotal": {
+                    "type": "number"
+                },
+                "tax": {
+                    "type": "number"
+                },
+                "total": {
+                    "type": "number"
+                },
                 "updatedAt": {
                     "type": "integer"
                 },
@@ -1247,6 +2422,63 @@ const docTemplate = `{
                 }
             }
         },
+        "model.OrderItem": {
+            "type": "object",
+            "properties": {
+                "lineTotal": {
+                    "type": "number"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "productCode": {
+                    "type": "string"
+                },
+                "quantity": {
+                    "type": "integer"
+                },
+                "unitPrice": {
+                    "type": "number"
+                }
+            }
+        },
+        "model.OrderStatusChange": {
+            "type": "object",
+            "properties": {
+                "actor": {
+                    "type": "string"
+                },
+                "changedAt": {
+                    "type": "integer"
+                },
+                "note": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "model.OrderTimeline": {
+            "type": "object",
+            "properties": {
+                "deliveryDuration": {
+                    "type": "integer"
+                },
+                "history": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.OrderStatusChange"
+                    }
+                },
+                "prepDuration": {
+                    "type": "integer"
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
         "model.Product": {
             "type": "object",
             "required": [
@@ -1293,12 +2525,35 @@ const docTemplate = `{
                     "type": "number",
                     "example": 9.99
                 },
+                "ratingHistogram": {
+                    "description": "RatingHistogram counts reviews by star, keyed \"1\" to \"5\".",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "integer"
+                    },
+                    "example": {
+                        "1": 0,
+                        "2": 0,
+                        "3": 1,
+                        "4": 2,
+                        "5": 4
+                    }
+                },
                 "ratingSum": {
                     "type": "number"
                 },
                 "reviewCount": {
                     "type": "integer"
                 },
+                "soldOut": {
+                    "type": "boolean"
+                },
+                "stock": {
+                    "type": "integer"
+                },
+                "stockResetAt": {
+                    "type": "integer"
+                },
                 "updatedAt": {
                     "type": "integer"
                 },
@@ -1310,6 +2565,29 @@ const docTemplate = `{
                 }
             }
         },
+        "model.ProductStock": {
+            "type": "object",
+            "properties": {
+                "canOrder": {
+                    "type": "boolean"
+                },
+                "code": {
+                    "type": "string"
+                },
+                "limit": {
+                    "type": "integer"
+                },
+                "soldOut": {
+                    "type": "boolean"
+                },
+                "stock": {
+                    "type": "integer"
+                },
+                "stockResetAt": {
+                    "type": "integer"
+                }
+            }
+        },
         "model.ProductView": {
             "type": "object",
             "required": [
@@ -1353,6 +2631,20 @@ const docTemplate = `{
                     "type": "number",
                     "example": 9.99
                 },
+                "ratingHistogram": {
+                    "description": "RatingHistogram counts reviews by star, keyed \"1\" to \"5\".",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "integer"
+                    },
+                    "example": {
+                        "1": 0,
+                        "2": 0,
+                        "3": 1,
+                        "4": 2,
+                        "5": 4
+                    }
+                },
                 "ratingSum": {
                     "type": "number"
                 },
@@ -1371,6 +2663,12 @@ const docTemplate = `{
                     "type": "string",
                     "example": "Incredible!"
                 },
+                "createdAt": {
+                    "type": "integer"
+                },
+                "hidden": {
+                    "type": "boolean"
+                },
                 "orderID": {
                     "type": "string"
                 },
@@ -1382,16 +2680,20 @@ const docTemplate = `{
                 },
                 "reviewProducts": {
                     "type": "array",
+                    "uniqueItems": true,
                     "items": {
                         "$ref": "#/definitions/dto.ReviewProductCreate"
                     }
                 },
+                "updatedAt": {
+                    "type": "integer"
+                },
                 "username": {
                     "type": "string"
                 }
             }
         },
-        "model.ReviewProduct": {
+        "model.ReviewView": {
             "type": "object",
             "required": [
                 "isLiked",
@@ -1402,6 +2704,9 @@ const docTemplate = `{
                     "type": "string",
                     "example": "Good!"
                 },
+                "createdAt": {
+                    "type": "integer"
+                },
                 "isLiked": {
                     "type": "boolean",
                     "example": false
@@ -1409,19 +2714,73 @@ const docTemplate = `{
                 "productCode": {
                     "type": "string",
                     "example": "bc01"
+                },
+                "rating": {
+                    "type": "integer",
+                    "maximum": 5,
+                    "minimum": 1,
+                    "example": 5
+                },
+                "username": {
+                    "type": "string"
                 }
             }
         },
         "model.Token": {
             "type": "object",
             "properties": {
+                "expiresIn": {
+                    "type": "integer"
+                },
                 "jwtToken": {
                     "type": "string"
                 },
+                "refreshToken": {
+                    "type": "string"
+                },
                 "userRole": {
                     "type": "string"
                 }
             }
+        },
+        "model.User": {
+            "type": "object",
+            "required": [
+                "address",
+                "email",
+                "phone",
+                "username"
+            ],
+            "properties": {
+                "address": {
+                    "$ref": "#/definitions/dto.AddressCreate"
+                },
+                "createdAt": {
+                    "type": "integer"
+                },
+                "email": {
+                    "type": "string",
+                    "example": "abc1@gmail.com"
+                },
+                "phone": {
+                    "type": "string",
+                    "example": "+821011112222"
+                },
+                "roles": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "updatedAt": {
+                    "type": "integer"
+                },
+                "username": {
+                    "type": "string",
+                    "maxLength": 30,
+                    "example": "abc1"
+                }
+            }
         }
     },
     "securityDefinitions": {
@@ -1,5 +1,7 @@
 package dto
 
+import "time"
+
 type OrderCreate struct {
 	User UserCreate `json:"user" bson:"user" binding:"required"`
 	OrderUpdateCart
@@ -7,6 +9,7 @@ type OrderCreate struct {
 
 type OrderUpdateStatus struct {
 	Status string `json:"status" bson:"status" binding:"required,oneof=Submitting Submitted Cooking Cooked Delivering Delivered Cancelled"`
+	Note   string `json:"note" bson:"note" binding:"max=200" example:"Extra napkins"`
 }
 
 type OrderUpdateCart struct {
@@ -27,18 +30,80 @@ type ProductUpdate struct {
 	CanView  bool    `json:"canView" bson:"canView" binding:"required" example:"true"`
 }
 
+type StockUpdate struct {
+	Stock int `json:"stock" binding:"min=0" example:"20"`
+}
+
 type ReviewOrderCreate struct {
 	Rating         float64               `json:"rating" bson:"rating" binding:"required,min=0,max=5" example:"4.5"`
 	Comment        string                `json:"comment" bson:"comment" example:"Incredible!"`
-	ReviewProducts []ReviewProductCreate `json:"reviewProducts" bson:"reviewProducts"`
+	ReviewProducts []ReviewProductCreate `json:"reviewProducts" bson:"reviewProducts" binding:"unique=ProductCode"`
+}
+
+// PageQuery is the pagination contract of every list endpoint: pass the
+// nextCursor of a page as cursor to get the page after it.
+type PageQuery struct {
+	Limit  int    `form:"limit" binding:"omitempty,min=1,max=100" example:"20"`
+	Cursor string `form:"cursor" example:""`
+	Total  bool   `form:"total" example:"false"`
+}
+
+type OrderQuery struct {
+	Status   []string  `form:"status" binding:"omitempty,dive,oneof=Submitting Submitted Cooking Cooked Delivering Delivered Cancelled" example:"Submitted"`
+	Username string    `form:"username" example:"username"`
+	From     time.Time `form:"from" example:"2023-01-01T00:00:00Z"`
+	To       time.Time `form:"to" example:"2023-02-01T00:00:00Z"`
+	PageQuery
+}
+
+type CustomerOrderQuery struct {
+	State string `form:"state" binding:"omitempty,oneof=active history all" example:"active"`
+	PageQuery
+}
+
+type ProductQuery struct {
+	Sort      string `form:"sort" binding:"omitempty,oneof=ratings reorders likes time" example:"ratings"`
+	Then      string `form:"then" binding:"omitempty,oneof=ratings reorders likes time,nefield=Sort" example:"time"`
+	Order     string `form:"order" binding:"omitempty,oneof=asc desc" example:"desc"`
+	Orderable bool   `form:"orderable" example:"false"`
+	PageQuery
+}
+
+type ReviewQuery struct {
+	Sort        string `form:"sort" binding:"omitempty,oneof=newest highest lowest" example:"newest"`
+	WithComment bool   `form:"withComment" example:"false"`
+	PageQuery
+}
+
+type ReviewUpdateHidden struct {
+	Hidden bool `json:"hidden" example:"true"`
 }
 
 type ReviewProductCreate struct {
 	ProductCode string `json:"productCode" bson:"productCode" binding:"required" example:"bc01"`
 	IsLiked     bool   `json:"isLiked" bson:"isLiked" binding:"required" example:"false"`
+	Rating      int    `json:"rating,omitempty" bson:"rating,omitempty" binding:"omitempty,min=1,max=5" example:"5"`
 	Comment     string `json:"comment" bson:"comment" example:"Good!"`
 }
 
+type AccountCreate struct {
+	Password string `json:"password" binding:"required,min=8,max=72" example:"password1234"`
+	UserCreate
+}
+
+type RoleGrant struct {
+	Role string `json:"role" binding:"required,oneof=customer provider" example:"provider"`
+}
+
+type AccountLogin struct {
+	Username string `json:"username" binding:"required,alphanum,max=30" example:"abc1"`
+	Password string `json:"password" binding:"required,max=72" example:"password1234"`
+}
+
+type TokenRefresh struct {
+	RefreshToken string `json:"refreshToken" binding:"required" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+}
+
 type UserCreate struct {
 	Username string        `json:"username" bson:"username" binding:"required,alphanum,max=30" example:"abc1"`
 	Email    string        `json:"email" bson:"email" binding:"required,email" example:"abc1@gmail.com"`
@@ -2,12 +2,50 @@ package dto
 
 import "github.com/gin-gonic/gin"
 
-var Response HTTPResponse
+// Machine-readable error codes returned in HTTPResponse.Error.
+const (
+	ErrCodeTokenMissing           = "token_missing"
+	ErrCodeTokenInvalid           = "token_invalid"
+	ErrCodeTokenExpired           = "token_expired"
+	ErrCodeTokenRevoked           = "token_revoked"
+	ErrCodeInsufficientScope      = "insufficient_scope"
+	ErrCodeNotOwner               = "not_owner"
+	ErrCodeIllegalTransition      = "illegal_transition"
+	ErrCodeTransitionNotPermitted = "transition_not_permitted"
+	ErrCodeInvalidCredentials     = "invalid_credentials"
+	ErrCodeInvalidCart            = "invalid_cart"
+	ErrCodeInvalidCursor          = "invalid_cursor"
+	ErrCodeReviewExists           = "review_exists"
+	ErrCodeOrderNotDelivered      = "order_not_delivered"
+	ErrCodeProductNotInOrder      = "product_not_in_order"
+	ErrCodeServerError            = "server_error"
+)
 
 type HTTPResponse struct {
-	Code int         `json:"code"`
-	Text string      `json:"text"`
-	Data interface{} `json:"data"`
+	Code  int         `json:"code"`
+	Text  string      `json:"text"`
+	Error string      `json:"error,omitempty"`
+	Data  interface{} `json:"data"`
+}
+
+// Page is one page of a list. NextCursor is empty on the last page and Total
+// is only counted when asked for.
+type Page struct {
+	Items      interface{} `json:"items"`
+	NextCursor string      `json:"nextCursor,omitempty"`
+	Total      *int64      `json:"total,omitempty"`
+}
+
+// CartLineError explains why a cart line was rejected.
+type CartLineError struct {
+	ProductCode string `json:"productCode" example:"bc01"`
+	Quantity    int    `json:"quantity" example:"0"`
+	Reason      string `json:"reason" example:"quantity must be positive"`
+}
+
+// NewResponse starts an empty response, to be filled in by the setters below.
+func NewResponse() HTTPResponse {
+	return HTTPResponse{}
 }
 
 func (response HTTPResponse) SetCode(statusCode int) HTTPResponse {
@@ -20,6 +58,11 @@ func (response HTTPResponse) SetText(statusMessage string) HTTPResponse {
 	return response
 }
 
+func (response HTTPResponse) SetError(errorCode string) HTTPResponse {
+	response.Error = errorCode
+	return response
+}
+
 func (response HTTPResponse) SetData(rawResponse interface{}) HTTPResponse {
 	response.Data = rawResponse
 	return response
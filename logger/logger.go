@@ -1,7 +1,6 @@
 package logger
 
 import (
-	"bytes"
 	"fmt"
 	"net"
 	"net/http"
@@ -19,9 +18,9 @@ import (
 	"oos/config"
 )
 
-var lg *zap.Logger
-
-func InitLogger(cfg *config.Config) (err error) {
+// New builds a logger that writes to the daily log file set in cfg. The level
+// belongs to this logger alone and can be changed while it runs.
+func New(cfg *config.Config) (*zap.Logger, zap.AtomicLevel, error) {
 	cf := cfg.Log
 
 	now := time.Now()
@@ -29,86 +28,13 @@ func InitLogger(cfg *config.Config) (err error) {
 
 	writeSyncer := getLogWriter(lPath, cf.Msize, cf.Mbackup, cf.Mage)
 	encoder := getEncoder()
-	var l = new(zapcore.Level)
-	err = l.UnmarshalText([]byte(cf.Level))
+	level, err := zap.ParseAtomicLevel(cf.Level)
 	if err != nil {
-		return
-	}
-	core := zapcore.NewCore(encoder, writeSyncer, l)
-
-	lg = zap.New(core, zap.AddCaller())
-	zap.ReplaceGlobals(lg)
-	return
-}
-
-func Debug(ctx ...interface{}) {
-	var b bytes.Buffer
-	for _, str := range ctx {
-		b.WriteString(str.(string))
-		b.WriteString(" ")
-	}
-
-	lg.Debug("debug", zap.String("-", b.String()))
-}
-
-func Info(ctx ...interface{}) {
-	var b bytes.Buffer
-	for _, str := range ctx {
-		b.WriteString(str.(string))
-		b.WriteString(" ")
-	}
-
-	lg.Info("info", zap.String("-", b.String()))
-}
-
-func Warn(ctx ...interface{}) {
-	var b bytes.Buffer
-	for _, str := range ctx {
-		b.WriteString(str.(string))
-		b.WriteString(" ")
-	}
-
-	lg.Warn("warn", zap.String("-", b.String()))
-}
-
-func Error(ctx ...interface{}) {
-	var b bytes.Buffer
-	for _, str := range ctx {
-		b.WriteString(str.(string))
-		b.WriteString(" ")
-	}
-
-	lg.Error("error", zap.String("-", b.String()))
-}
-
-func DPanic(ctx ...interface{}) {
-	var b bytes.Buffer
-	for _, str := range ctx {
-		b.WriteString(str.(string))
-		b.WriteString(" ")
-	}
-
-	lg.DPanic("dpanic", zap.String("-", b.String()))
-}
-
-func Panic(ctx ...interface{}) {
-	var b bytes.Buffer
-	for _, str := range ctx {
-		b.WriteString(str.(string))
-		b.WriteString(" ")
-	}
-
-	lg.Panic("panic", zap.String("-", b.String()))
-}
-
-func Fatal(ctx ...interface{}) {
-	var b bytes.Buffer
-	for _, str := range ctx {
-		b.WriteString(str.(string))
-		b.WriteString(" ")
+		return nil, level, err
 	}
+	core := zapcore.NewCore(encoder, writeSyncer, level)
 
-	lg.Fatal("fatal", zap.String("-", b.String()))
+	return zap.New(core, zap.AddCaller()), level, nil
 }
 
 func getEncoder() zapcore.Encoder {
@@ -131,7 +57,7 @@ func getLogWriter(filename string, maxSize, maxBackup, maxAge int) zapcore.Write
 	return zapcore.AddSync(lumberJackLogger)
 }
 
-func GinLogger() gin.HandlerFunc {
+func GinLogger(lg *zap.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		start := time.Now()
 		path := c.Request.URL.Path
@@ -152,7 +78,7 @@ func GinLogger() gin.HandlerFunc {
 	}
 }
 
-func GinRecovery(stack bool) gin.HandlerFunc {
+func GinRecovery(lg *zap.Logger, stack bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		defer func() {
 			if err := recover(); err != nil {
@@ -2,20 +2,28 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io/fs"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
 
+	"oos/app"
 	"oos/config"
 	"oos/db"
 	"oos/logger"
+	"oos/migrations"
+	"oos/repository"
 	"oos/router"
 )
 
@@ -37,68 +45,214 @@ var g errgroup.Group
 func main() {
 	// Configuration
 	var configFlag = flag.String("config", "./config/config.toml", "TOML file for configuration")
+	var migrateFlag = flag.String("migrate", "", "Run database migrations (up, down or status) and exit")
+	var grantProviderFlag = flag.String("grant-provider", "", "Grant the provider role to a registered user and exit")
+	var modeFlag = flag.String("mode", "", "Server mode: debug, release or test (overrides server.mode)")
+	var portFlag = flag.String("port", "", "Address to listen on, e.g. :8080 (overrides server.port)")
+	var dbHostFlag = flag.String("db-host", "", "MongoDB URI (overrides db.host)")
+	var dbNameFlag = flag.String("db-name", "", "MongoDB database name (overrides db.name)")
+	var logLevelFlag = flag.String("log-level", "", "Log level (overrides log.level)")
 	flag.Parse()
+
+	// Variables in .env are read like the rest of the environment, which
+	// overrides the configuration file.
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		fmt.Printf("Loading .env failed, err:%v\n", err)
+		os.Exit(1)
+	}
+
 	cfg, err := config.GetConfig(*configFlag)
 	if err != nil {
 		fmt.Printf("GetConfig failed, err:%v\n", err)
-		logger.Fatal("Error configuration file")
-		return
+		os.Exit(1)
+	}
+	// Flags override the file and the environment, also on reload.
+	applyFlags := func(cfg *config.Config) {
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "mode":
+				cfg.Server.Mode = *modeFlag
+			case "port":
+				cfg.Server.Port = *portFlag
+			case "db-host":
+				cfg.DB.Host = *dbHostFlag
+			case "db-name":
+				cfg.DB.Name = *dbNameFlag
+			case "log-level":
+				cfg.Log.Level = *logLevelFlag
+			}
+		})
+	}
+	applyFlags(cfg)
+	if err := cfg.Validate(); err != nil {
+		var invalid *config.ValidationError
+		if errors.As(err, &invalid) {
+			for _, problem := range invalid.Problems {
+				fmt.Println("Invalid configuration:", problem)
+			}
+		}
+		os.Exit(1)
 	}
 
 	// Logger
-	if err := logger.InitLogger(cfg); err != nil {
-		fmt.Printf("InitLogger failed, err:%v\n", err)
-		logger.Fatal("Error loading logger")
+	lg, level, err := logger.New(cfg)
+	if err != nil {
+		fmt.Printf("New logger failed, err:%v\n", err)
+		os.Exit(1)
+	}
+
+	// Database
+	database, err := db.Connect(cfg)
+	if err != nil {
+		fmt.Printf("Connect failed, err:%v\n", err)
+		lg.Fatal("Error connecting database", zap.Error(err))
+		return
+	}
+	if *migrateFlag != "" {
+		if err := migrate(database, *migrateFlag); err != nil {
+			fmt.Printf("Migration failed, err:%v\n", err)
+			lg.Fatal("Error migrating database", zap.Error(err))
+		}
+		return
+	}
+	if _, err := migrations.Up(context.Background(), database); err != nil {
+		fmt.Printf("Migration failed, err:%v\n", err)
+		lg.Fatal("Error migrating database", zap.Error(err))
 		return
 	}
 
-	// Environment variables
-	if err := godotenv.Load(); err != nil {
-		fmt.Printf("Loading .env failed, err:%v\n", err)
-        logger.Fatal("Error loading .env file")
+	// Application
+	a, err := app.New(cfg, lg, level, database.Client(), repository.NewMongo(database))
+	if err != nil {
+		fmt.Printf("New app failed, err:%v\n", err)
+		lg.Fatal("Error loading signing key", zap.Error(err))
 		return
-    }
+	}
 
-	// Database
-	db.ConnectDB(cfg)
+	if *grantProviderFlag != "" {
+		if _, err := a.Service.GrantRole(context.Background(), *grantProviderFlag, "provider"); err != nil {
+			fmt.Printf("Grant failed, err:%v\n", err)
+			lg.Fatal("Error granting provider role", zap.Error(err))
+		}
+		fmt.Printf("Granted provider to %s\n", *grantProviderFlag)
+		return
+	}
 
 	// Server: start
-	logger.Debug("Ready server")
+	lg.Debug("Ready server")
+
+	// The Gin mode is global, so it is set once here rather than per App.
+	gin.SetMode(cfg.Server.Mode)
 
 	mapi := &http.Server{
 		Addr:           cfg.Server.Port,
-		Handler:        router.Engine(),
+		Handler:        router.Engine(a),
 		ReadTimeout:    5 * time.Second,
 		WriteTimeout:   10 * time.Second,
 		MaxHeaderBytes: 1 << 20,
 	}
 
 	g.Go(func() error {
-		return mapi.ListenAndServe()
+		if err := mapi.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
 	})
 
-	// Server: graceful shutdown
+	// Stock: periodic reset
+	stockCtx, stopStock := context.WithCancel(context.Background())
+	g.Go(func() error {
+		return a.Service.RunStockReset(stockCtx, cfg)
+	})
+
+	// Configuration: reload on SIGHUP, graceful shutdown on anything else
 	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-	
-	logger.Warn("Shutdown server")
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range quit {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		reload(a, *configFlag, applyFlags)
+	}
+
+	// Server: graceful shutdown
+
+	lg.Warn("Shutdown server")
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
+	stopStock()
 	if err := mapi.Shutdown(ctx); err != nil {
-		logger.Error("Server shutdown:", err)
+		lg.Error("Server shutdown", zap.Error(err))
 	}
 
 	select {
 	case <-ctx.Done():
-		logger.Info("Timeout 5 seconds")
+		lg.Info("Timeout 5 seconds")
 	default:
 	}
 
-	logger.Info("Server exiting")
+	lg.Info("Server exiting")
+	a.Close(ctx)
 
 	if err := g.Wait(); err != nil {
-		logger.Error(err)
+		lg.Error("Server error", zap.Error(err))
+	}
+}
+
+// reload reads the configuration again and applies it to a. An invalid
+// configuration is logged and leaves a unchanged.
+func reload(a *app.App, fpath string, applyFlags func(*config.Config)) {
+	a.Logger.Info("Reload configuration")
+
+	cfg, err := config.GetConfig(fpath)
+	if err != nil {
+		a.Logger.Error("Reload failed", zap.Error(err))
+		return
+	}
+	applyFlags(cfg)
+	if err := cfg.Validate(); err != nil {
+		a.Logger.Error("Reload failed", zap.Error(err))
+		return
+	}
+
+	warnings, err := a.Reload(cfg)
+	for _, warning := range warnings {
+		a.Logger.Warn("Reload", zap.String("warning", warning))
+	}
+	if err != nil {
+		a.Logger.Error("Reload failed", zap.Error(err))
+	}
+}
+
+// migrate runs a migration command given by the -migrate flag.
+func migrate(database *mongo.Database, command string) error {
+	ctx := context.Background()
+
+	switch command {
+	case "up":
+		applied, err := migrations.Up(ctx, database)
+		for _, migration := range applied {
+			fmt.Printf("Applied %d %s\n", migration.Version, migration.Name)
+		}
+		return err
+	case "down":
+		undone, err := migrations.Down(ctx, database)
+		if undone != nil {
+			fmt.Printf("Undid %d %s\n", undone.Version, undone.Name)
+		}
+		return err
+	case "status":
+		statuses, err := migrations.List(ctx, database)
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%d %s %s\n", status.Version, status.Name, appliedAt)
+		}
+		return err
+	default:
+		return fmt.Errorf("unknown migrate command %q", command)
 	}
 }
@@ -1,22 +1,109 @@
 package middleware
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"time"
 
 	jwt "github.com/golang-jwt/jwt/v4"
+	"go.uber.org/zap"
+
+	"oos/config"
+	"oos/service"
 )
 
-func CreateAccessToken(permission string) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"iss":   "go-jwt-middleware-example",
-		"aud":   "audience-example",
-		"sub":   "1234567890",
-		"iat":   time.Now().Unix(),
-		"scope": permission,
-	})
-	tokenString, err := token.SignedString(signingKey)
+const (
+	tokenUseAccess  = "access"
+	tokenUseRefresh = "refresh"
+)
+
+// Auth issues the tokens of one application and validates the tokens
+// presented to it.
+type Auth struct {
+	issuer     string
+	audience   []string
+	keys       keyring
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+
+	service *service.Service
+	logger  *zap.Logger
+}
+
+// NewAuth loads the issuer, audience, signing keys and token lifetimes.
+// Revoked tokens are looked up through svc.
+func NewAuth(cfg *config.Config, lg *zap.Logger, svc *service.Service) (*Auth, error) {
+	cf := cfg.Auth
+	a := &Auth{
+		issuer:     cf.Issuer,
+		audience:   cf.Audience,
+		accessTTL:  time.Duration(cf.AccessTTL) * time.Minute,
+		refreshTTL: time.Duration(cf.RefreshTTL) * time.Minute,
+		service:    svc,
+		logger:     lg,
+	}
+	if a.issuer == "" {
+		return nil, errors.New("no JWT issuer configured")
+	}
+	if len(a.audience) == 0 {
+		return nil, errors.New("no JWT audience configured")
+	}
+
+	kr, err := loadKeys(cf.Algorithm, cf.Secret, cf.SigningKey, cf.Keys)
+	if err != nil {
+		return nil, err
+	}
+	a.keys = kr
+
+	return a, nil
+}
+
+func (a *Auth) AccessTokenTTL() time.Duration {
+	return a.accessTTL
+}
+
+func (a *Auth) CreateAccessToken(username string, permission string) (string, error) {
+	tokenString, err := a.createToken(username, permission, tokenUseAccess, a.accessTTL)
 	return "Bearer " + tokenString, err
 }
 
+func (a *Auth) CreateRefreshToken(username string, permission string) (string, error) {
+	return a.createToken(username, permission, tokenUseRefresh, a.refreshTTL)
+}
+
+func (a *Auth) createToken(username string, permission string, use string, ttl time.Duration) (string, error) {
+	tokenID, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(a.keys.method, jwt.MapClaims{
+		"iss":       a.issuer,
+		"aud":       a.audience,
+		"sub":       username,
+		"iat":       now.Unix(),
+		"exp":       now.Add(ttl).Unix(),
+		"jti":       tokenID,
+		"scope":     permission,
+		"token_use": use,
+	})
+	if a.keys.signingKID != "" {
+		token.Header["kid"] = a.keys.signingKID
+	}
+	return token.SignedString(a.keys.signingKey)
+}
+
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
 // References
 // https://pkg.go.dev/github.com/golang-jwt/jwt/v4#example-New-Hmac
+// https://pkg.go.dev/github.com/golang-jwt/jwt/v4#SigningMethodRSA
+// https://www.rfc-editor.org/rfc/rfc7519#section-4.1.7
@@ -2,6 +2,9 @@ package middleware
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strings"
 	"time"
@@ -10,31 +13,42 @@ import (
 	"github.com/auth0/go-jwt-middleware/v2/validator"
 	"github.com/gin-gonic/gin"
 	adapter "github.com/gwatts/gin-adapter"
+	"go.uber.org/zap"
+	"gopkg.in/square/go-jose.v2/jwt"
 
-	"oos/logger"
+	"oos/dto"
 )
 
 var (
-	signingKey = []byte("secret")
+	customClaims = func() validator.CustomClaims {
+		return &CustomClaims{}
+	}
 
-	keyFunc = func(ctx context.Context) (interface{}, error) {
-		return signingKey, nil
+	refreshClaims = func() validator.CustomClaims {
+		return &RefreshClaims{}
 	}
 
-	issuer = "go-jwt-middleware-example"
+	ErrTokenRevoked = errors.New("token has been revoked")
 
-	audience = []string{"audience-example"}
+	errRevocationCheck = errors.New("could not check token revocation")
+)
 
-	customClaims = func() validator.CustomClaims {
-		return &CustomClaims{}
-	}
+// Gin context keys under which ValidateScope stores the subject of the
+// validated token and the scope it was granted access with.
+const (
+	UsernameKey = "username"
+	RoleKey     = "role"
 )
 
 type CustomClaims struct {
-	Scope string `json:"scope"`
+	Scope    string `json:"scope"`
+	TokenUse string `json:"token_use"`
 }
 
 func (c CustomClaims) Validate(ctx context.Context) error {
+	if c.TokenUse != tokenUseAccess {
+		return errors.New("not an access token")
+	}
 	return nil
 }
 
@@ -50,63 +64,206 @@ func (c CustomClaims) HasScope(expectedScope string) bool {
 	return false
 }
 
-func ValidateToken() gin.HandlerFunc {
+// RefreshClaims are the custom claims of a refresh token, which is only
+// accepted by ValidateRefreshToken and never as a bearer token.
+type RefreshClaims struct {
+	Scope    string `json:"scope"`
+	TokenUse string `json:"token_use"`
+}
+
+func (c RefreshClaims) Validate(ctx context.Context) error {
+	if c.TokenUse != tokenUseRefresh {
+		return errors.New("not a refresh token")
+	}
+	return nil
+}
+
+func (a *Auth) ValidateToken() gin.HandlerFunc {
 	jwtValidator, err := validator.New(
-		keyFunc,
-		validator.HS256,
-		issuer,
-		audience,
+		a.keyFunc,
+		a.keys.algorithm,
+		a.issuer,
+		a.audience,
 		validator.WithCustomClaims(customClaims),
 		validator.WithAllowedClockSkew(30*time.Second),
 	)
 	if err != nil {
-		logger.Fatal("failed to set up the validator: %v", err)
+		a.logger.Fatal("failed to set up the validator", zap.Error(err))
+	}
+
+	validateToken := func(ctx context.Context, tokenString string) (interface{}, error) {
+		claims, err := jwtValidator.ValidateToken(ctx, tokenString)
+		if err != nil {
+			return nil, err
+		}
+		if err := a.checkRevoked(ctx, claims.(*validator.ValidatedClaims)); err != nil {
+			return nil, err
+		}
+		return claims, nil
 	}
 
 	errorHandler := func(w http.ResponseWriter, r *http.Request, err error) {
-		logger.Error("encountered error while validating JWT: %v", err)
+		status, errorCode := ClassifyTokenError(err)
+		if status == http.StatusInternalServerError {
+			a.logger.Error("encountered error while validating JWT", zap.Error(err))
+		}
+
+		w.Header().Set("WWW-Authenticate", a.bearerChallenge(errorCode, ""))
+		writeJSON(w, dto.NewResponse().
+			SetCode(status).
+			SetText(http.StatusText(status)).
+			SetError(errorCode).
+			SetData(err.Error()))
 	}
 
 	jwtMiddleware := jwtmiddleware.New(
-		jwtValidator.ValidateToken,
+		validateToken,
 		jwtmiddleware.WithErrorHandler(errorHandler),
 	)
 
 	return adapter.Wrap(jwtMiddleware.CheckJWT)
 }
 
-func ValidateScope(permission string) gin.HandlerFunc {
+// ValidateRefreshToken checks the signature, expiry and revocation status of a
+// refresh token and returns its claims.
+func (a *Auth) ValidateRefreshToken(ctx context.Context, tokenString string) (*validator.ValidatedClaims, error) {
+	jwtValidator, err := validator.New(
+		a.keyFunc,
+		a.keys.algorithm,
+		a.issuer,
+		a.audience,
+		validator.WithCustomClaims(refreshClaims),
+		validator.WithAllowedClockSkew(30*time.Second),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := jwtValidator.ValidateToken(ctx, tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := result.(*validator.ValidatedClaims)
+	if err := a.checkRevoked(ctx, claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func (a *Auth) checkRevoked(ctx context.Context, claims *validator.ValidatedClaims) error {
+	revoked, err := a.service.IsTokenRevoked(ctx, claims.RegisteredClaims.ID)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errRevocationCheck, err)
+	}
+	if revoked {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+// TokenClaims returns the claims of the bearer token validated by ValidateToken.
+func TokenClaims(ctx *gin.Context) (*validator.ValidatedClaims, bool) {
+	claims, ok := ctx.Request.Context().Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	return claims, ok
+}
+
+func (a *Auth) ValidateScope(permission string) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		claims, ok := ctx.Request.Context().Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+		claims, ok := TokenClaims(ctx)
 		if !ok {
-			ctx.AbortWithStatusJSON(
-				http.StatusInternalServerError,
-				map[string]string{"message": "Failed to get validated JWT claims."},
-			)
+			dto.NewResponse().
+				SetCode(http.StatusInternalServerError).
+				SetText(http.StatusText(http.StatusInternalServerError)).
+				SetError(dto.ErrCodeServerError).
+				SetData("Failed to get validated JWT claims.").
+				AbortWithStatusJSON(ctx)
 			return
 		}
 
 		customClaims, ok := claims.CustomClaims.(*CustomClaims)
 		if !ok {
-			ctx.AbortWithStatusJSON(
-				http.StatusInternalServerError,
-				map[string]string{"message": "Failed to cast custom JWT claims to specific type."},
-			)
+			dto.NewResponse().
+				SetCode(http.StatusInternalServerError).
+				SetText(http.StatusText(http.StatusInternalServerError)).
+				SetError(dto.ErrCodeServerError).
+				SetData("Failed to cast custom JWT claims to specific type.").
+				AbortWithStatusJSON(ctx)
 			return
 		}
 
 		if !customClaims.HasScope(permission) {
-			ctx.AbortWithStatusJSON(
-				http.StatusBadRequest,
-				map[string]string{"message": "Insufficient scope."},
-			)
+			ctx.Header("WWW-Authenticate", a.bearerChallenge(dto.ErrCodeInsufficientScope, permission))
+			dto.NewResponse().
+				SetCode(http.StatusForbidden).
+				SetText(http.StatusText(http.StatusForbidden)).
+				SetError(dto.ErrCodeInsufficientScope).
+				SetData("Insufficient scope.").
+				AbortWithStatusJSON(ctx)
 			return
 		}
 
+		ctx.Set(UsernameKey, claims.RegisteredClaims.Subject)
+		ctx.Set(RoleKey, permission)
+
 		ctx.Next()
 	}
 }
 
+// ClassifyTokenError maps a token validation error to a status code and
+// error code.
+func ClassifyTokenError(err error) (int, string) {
+	switch {
+	case errors.Is(err, jwtmiddleware.ErrJWTMissing):
+		return http.StatusUnauthorized, dto.ErrCodeTokenMissing
+	case errors.Is(err, errRevocationCheck):
+		return http.StatusInternalServerError, dto.ErrCodeServerError
+	case errors.Is(err, ErrTokenRevoked):
+		return http.StatusUnauthorized, dto.ErrCodeTokenRevoked
+	case errors.Is(err, jwt.ErrExpired):
+		return http.StatusUnauthorized, dto.ErrCodeTokenExpired
+	case errors.Is(err, jwtmiddleware.ErrJWTInvalid):
+		return http.StatusUnauthorized, dto.ErrCodeTokenInvalid
+	default:
+		// The token could not be extracted, e.g. a malformed Authorization header.
+		return http.StatusUnauthorized, dto.ErrCodeTokenInvalid
+	}
+}
+
+// bearerChallenge builds the WWW-Authenticate header of RFC 6750. A missing
+// token gets a bare challenge without an error attribute.
+func (a *Auth) bearerChallenge(errorCode string, scope string) string {
+	challenge := `Bearer realm="` + a.issuer + `"`
+	switch errorCode {
+	case dto.ErrCodeTokenMissing, dto.ErrCodeServerError:
+	case dto.ErrCodeInsufficientScope:
+		challenge += `, error="insufficient_scope", scope="` + scope + `"`
+	default:
+		challenge += `, error="invalid_token"`
+	}
+	return challenge
+}
+
+// writeJSON writes the response envelope outside of a gin handler, e.g. from
+// the net/http error handler of the JWT middleware.
+func writeJSON(w http.ResponseWriter, response dto.HTTPResponse) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(response.Code)
+	json.NewEncoder(w).Encode(response)
+}
+
+// Username returns the authenticated username set by ValidateScope.
+func Username(ctx *gin.Context) string {
+	return ctx.GetString(UsernameKey)
+}
+
+// Role returns the role of the route group that ValidateScope guards.
+func Role(ctx *gin.Context) string {
+	return ctx.GetString(RoleKey)
+}
+
 // References
 // https://github.com/auth0/go-jwt-middleware/tree/master/examples/gin-example
+// https://www.rfc-editor.org/rfc/rfc6750#section-3
 // https://dev.to/ksivamuthu/auth0-jwt-middleware-in-go-gin-web-framework-37mj
@@ -1,13 +1,66 @@
 package middleware
 
-import "github.com/gin-gonic/gin"
+import (
+	"strings"
+	"sync/atomic"
 
-func CORS() gin.HandlerFunc {
+	"github.com/gin-gonic/gin"
+
+	"oos/config"
+)
+
+// CORS answers cross-origin requests with the settings it was last given,
+// which can be replaced while the server runs.
+type CORS struct {
+	policy atomic.Value // *corsPolicy
+}
+
+type corsPolicy struct {
+	anyOrigin bool
+	origins   map[string]bool
+	methods   string
+	headers   string
+}
+
+func NewCORS(cf config.CORSConfig) *CORS {
+	c := &CORS{}
+	c.Update(cf)
+	return c
+}
+
+// Update replaces the settings used from the next request on.
+func (c *CORS) Update(cf config.CORSConfig) {
+	policy := &corsPolicy{
+		origins: map[string]bool{},
+		methods: strings.Join(cf.AllowMethods, ", "),
+		headers: strings.Join(cf.AllowHeaders, ", "),
+	}
+	for _, origin := range cf.AllowOrigins {
+		if origin == "*" {
+			policy.anyOrigin = true
+		}
+		policy.origins[origin] = true
+	}
+
+	c.policy.Store(policy)
+}
+
+func (c *CORS) Handler() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		ctx.Writer.Header().Set("Access-Control-Allow-Origin", "*")
+		policy := c.policy.Load().(*corsPolicy)
+
+		if policy.anyOrigin {
+			ctx.Writer.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			// Only a listed origin is echoed back, so caches must key on it.
+			ctx.Writer.Header().Add("Vary", "Origin")
+			if origin := ctx.GetHeader("Origin"); policy.origins[origin] {
+				ctx.Writer.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+		}
 		ctx.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		ctx.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, X-Forwarded-For, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		ctx.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+		ctx.Writer.Header().Set("Access-Control-Allow-Headers", policy.headers)
+		ctx.Writer.Header().Set("Access-Control-Allow-Methods", policy.methods)
 		if ctx.Request.Method == "OPTIONS" {
 			ctx.AbortWithStatus(204)
 			return
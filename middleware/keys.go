@@ -0,0 +1,156 @@
+package middleware
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/auth0/go-jwt-middleware/v2/validator"
+	jwt "github.com/golang-jwt/jwt/v4"
+	"gopkg.in/square/go-jose.v2"
+
+	"oos/config"
+)
+
+// keyring holds the keys that sign new tokens and verify presented ones.
+type keyring struct {
+	algorithm  validator.SignatureAlgorithm
+	method     jwt.SigningMethod
+	signingKID string
+	signingKey interface{}
+	verifyKeys jose.JSONWebKeySet
+}
+
+// keyFunc hands the validator either the HMAC secret or the whole key set,
+// from which the key matching the token's kid header is picked.
+func (a *Auth) keyFunc(ctx context.Context) (interface{}, error) {
+	if a.keys.signingKey == nil {
+		return nil, errors.New("no signing key loaded")
+	}
+	if a.keys.algorithm == validator.HS256 {
+		return a.keys.signingKey, nil
+	}
+	return &a.keys.verifyKeys, nil
+}
+
+func loadKeys(algorithm string, secret string, signingKID string, files []config.AuthKey) (keyring, error) {
+	switch algorithm {
+	case "", string(validator.HS256):
+		if secret == "" {
+			return keyring{}, errors.New("no JWT signing secret configured")
+		}
+		return keyring{
+			algorithm:  validator.HS256,
+			method:     jwt.SigningMethodHS256,
+			signingKey: []byte(secret),
+		}, nil
+	case string(validator.RS256):
+		return loadAsymmetricKeys(validator.RS256, jwt.SigningMethodRS256, signingKID, files)
+	case string(validator.ES256):
+		return loadAsymmetricKeys(validator.ES256, jwt.SigningMethodES256, signingKID, files)
+	default:
+		return keyring{}, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+}
+
+func loadAsymmetricKeys(algorithm validator.SignatureAlgorithm, method jwt.SigningMethod, signingKID string, files []config.AuthKey) (keyring, error) {
+	kr := keyring{
+		algorithm:  algorithm,
+		method:     method,
+		signingKID: signingKID,
+	}
+	if len(files) == 0 {
+		return keyring{}, fmt.Errorf("no keys configured for %s", algorithm)
+	}
+	if kr.signingKID == "" {
+		kr.signingKID = files[0].ID
+	}
+
+	for _, k := range files {
+		if k.ID == "" {
+			return keyring{}, fmt.Errorf("key %s has no id", k.File)
+		}
+		if len(kr.verifyKeys.Key(k.ID)) > 0 {
+			return keyring{}, fmt.Errorf("duplicate key id %q", k.ID)
+		}
+
+		pem, err := os.ReadFile(k.File)
+		if err != nil {
+			return keyring{}, err
+		}
+
+		private, public, err := parseKey(algorithm, pem)
+		if err != nil {
+			return keyring{}, fmt.Errorf("key %q: %w", k.ID, err)
+		}
+
+		if k.ID == kr.signingKID {
+			if private == nil {
+				return keyring{}, fmt.Errorf("signing key %q has no private part", k.ID)
+			}
+			kr.signingKey = private
+		}
+
+		kr.verifyKeys.Keys = append(kr.verifyKeys.Keys, jose.JSONWebKey{
+			Key:       public,
+			KeyID:     k.ID,
+			Algorithm: string(algorithm),
+			Use:       "sig",
+		})
+	}
+
+	if kr.signingKey == nil {
+		return keyring{}, fmt.Errorf("signing key %q is not configured", kr.signingKID)
+	}
+
+	return kr, nil
+}
+
+// parseKey accepts a private key, or a public key for a retired key that can
+// only verify.
+func parseKey(algorithm validator.SignatureAlgorithm, pem []byte) (interface{}, interface{}, error) {
+	switch algorithm {
+	case validator.RS256:
+		if private, err := jwt.ParseRSAPrivateKeyFromPEM(pem); err == nil {
+			return private, &private.PublicKey, nil
+		}
+		public, err := jwt.ParseRSAPublicKeyFromPEM(pem)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, public, nil
+	case validator.ES256:
+		var public *ecdsa.PublicKey
+		var private *ecdsa.PrivateKey
+		if key, err := jwt.ParseECPrivateKeyFromPEM(pem); err == nil {
+			private, public = key, &key.PublicKey
+		} else if public, err = jwt.ParseECPublicKeyFromPEM(pem); err != nil {
+			return nil, nil, err
+		}
+		if public.Curve != elliptic.P256() {
+			return nil, nil, errors.New("ES256 requires a P-256 key")
+		}
+		if private == nil {
+			return nil, public, nil
+		}
+		return private, public, nil
+	}
+
+	return nil, nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+}
+
+// PublicKeys returns the verification keys as a JWK set. It is empty for HS256,
+// whose secret must never be published.
+func (a *Auth) PublicKeys() jose.JSONWebKeySet {
+	if a.keys.algorithm == validator.HS256 {
+		return jose.JSONWebKeySet{Keys: []jose.JSONWebKey{}}
+	}
+	return a.keys.verifyKeys
+}
+
+// References
+// https://www.rfc-editor.org/rfc/rfc7517
+// https://pkg.go.dev/gopkg.in/square/go-jose.v2#JSONWebKeySet
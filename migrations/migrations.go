@@ -0,0 +1,137 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const collectionName = "schema_migrations"
+
+var ErrIrreversible = errors.New("migration cannot be undone")
+
+// Migration is one step of the database schema. Up and Down must be safe to
+// run more than once, since a crash may leave a step applied but unrecorded.
+// Down is nil when a step cannot be undone.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, database *mongo.Database) error
+	Down    func(ctx context.Context, database *mongo.Database) error
+}
+
+// Status tells whether a migration has been applied, and when.
+type Status struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"appliedAt,omitempty"`
+}
+
+type record struct {
+	Version   int       `bson:"_id"`
+	Name      string    `bson:"name"`
+	AppliedAt time.Time `bson:"appliedAt"`
+}
+
+// Up applies every migration that has not been applied yet, in order, and
+// returns the ones it applied.
+func Up(ctx context.Context, database *mongo.Database) ([]Migration, error) {
+	applied, err := appliedVersions(ctx, database)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, migration := range migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		if err := migration.Up(ctx, database); err != nil {
+			return done, fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, err)
+		}
+
+		r := record{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}
+		if _, err := database.Collection(collectionName).InsertOne(ctx, r); err != nil {
+			return done, err
+		}
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+// Down undoes the last applied migration and returns it, or nil if nothing
+// has been applied.
+func Down(ctx context.Context, database *mongo.Database) (*Migration, error) {
+	applied, err := appliedVersions(ctx, database)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		migration := migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+
+		if migration.Down == nil {
+			return nil, fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, ErrIrreversible)
+		}
+		if err := migration.Down(ctx, database); err != nil {
+			return nil, fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, err)
+		}
+
+		filter := bson.M{"_id": migration.Version}
+		if _, err := database.Collection(collectionName).DeleteOne(ctx, filter); err != nil {
+			return nil, err
+		}
+		return &migration, nil
+	}
+
+	return nil, nil
+}
+
+// List reports every known migration in order with the time it was applied.
+func List(ctx context.Context, database *mongo.Database) ([]Status, error) {
+	applied, err := appliedVersions(ctx, database)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, len(migrations))
+	for i, migration := range migrations {
+		statuses[i] = Status{Version: migration.Version, Name: migration.Name}
+		if r, ok := applied[migration.Version]; ok {
+			appliedAt := r.AppliedAt
+			statuses[i].AppliedAt = &appliedAt
+		}
+	}
+
+	return statuses, nil
+}
+
+func appliedVersions(ctx context.Context, database *mongo.Database) (map[int]record, error) {
+	opts := options.Find().SetSort(bson.M{"_id": 1})
+	cursor, err := database.Collection(collectionName).Find(ctx, bson.D{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	applied := map[int]record{}
+	for cursor.Next(ctx) {
+		var r record
+		if err := cursor.Decode(&r); err != nil {
+			return nil, err
+		}
+		applied[r.Version] = r
+	}
+
+	return applied, cursor.Err()
+}
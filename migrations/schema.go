@@ -0,0 +1,212 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Server error codes for a missing collection or index.
+const (
+	codeNamespaceNotFound = 26
+	codeIndexNotFound     = 27
+)
+
+// migrations is the schema history in the order it is applied. Append new
+// steps with the next version; never edit or reorder applied ones.
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "flatten_products",
+		Up:      flattenProducts,
+	},
+	{
+		Version: 2,
+		Name:    "flatten_reviews",
+		Up:      flattenReviews,
+	},
+	{
+		// Product codes should be unique.
+		Version: 3,
+		Name:    "products_code_index",
+		Up: func(ctx context.Context, database *mongo.Database) error {
+			// The old index was on a path that products never had.
+			if err := dropIndex(ctx, database.Collection("products"), "productquery.productcreate.code_1"); err != nil {
+				return err
+			}
+			return createIndex(ctx, database.Collection("products"), mongo.IndexModel{
+				Keys:    bson.D{{Key: "code", Value: 1}},
+				Options: options.Index().SetName("code_1").SetUnique(true),
+			})
+		},
+		Down: func(ctx context.Context, database *mongo.Database) error {
+			return dropIndex(ctx, database.Collection("products"), "code_1")
+		},
+	},
+	{
+		// Usernames should be unique.
+		Version: 4,
+		Name:    "users_username_index",
+		Up: func(ctx context.Context, database *mongo.Database) error {
+			return createIndex(ctx, database.Collection("users"), mongo.IndexModel{
+				Keys:    bson.D{{Key: "username", Value: 1}},
+				Options: options.Index().SetName("username_1").SetUnique(true),
+			})
+		},
+		Down: func(ctx context.Context, database *mongo.Database) error {
+			return dropIndex(ctx, database.Collection("users"), "username_1")
+		},
+	},
+	{
+		// Orders of a customer are listed by creation time.
+		Version: 5,
+		Name:    "orders_username_created_index",
+		Up: func(ctx context.Context, database *mongo.Database) error {
+			return createIndex(ctx, database.Collection("orders"), mongo.IndexModel{
+				Keys: bson.D{
+					{Key: "user.username", Value: 1},
+					{Key: "createdAt", Value: 1},
+				},
+				Options: options.Index().SetName("user.username_1_createdAt_1"),
+			})
+		},
+		Down: func(ctx context.Context, database *mongo.Database) error {
+			return dropIndex(ctx, database.Collection("orders"), "user.username_1_createdAt_1")
+		},
+	},
+	{
+		// An order can be reviewed only once.
+		Version: 6,
+		Name:    "reviews_order_index",
+		Up: func(ctx context.Context, database *mongo.Database) error {
+			return createIndex(ctx, database.Collection("reviews"), mongo.IndexModel{
+				Keys:    bson.D{{Key: "orderID", Value: 1}},
+				Options: options.Index().SetName("orderID_1").SetUnique(true),
+			})
+		},
+		Down: func(ctx context.Context, database *mongo.Database) error {
+			return dropIndex(ctx, database.Collection("reviews"), "orderID_1")
+		},
+	},
+	{
+		// Reviews of a product are looked up newest first.
+		Version: 7,
+		Name:    "reviews_product_created_index",
+		Up: func(ctx context.Context, database *mongo.Database) error {
+			return createIndex(ctx, database.Collection("reviews"), mongo.IndexModel{
+				Keys: bson.D{
+					{Key: "reviewProducts.productCode", Value: 1},
+					{Key: "createdAt", Value: -1},
+				},
+				Options: options.Index().SetName("reviewProducts.productCode_1_createdAt_-1"),
+			})
+		},
+		Down: func(ctx context.Context, database *mongo.Database) error {
+			return dropIndex(ctx, database.Collection("reviews"), "reviewProducts.productCode_1_createdAt_-1")
+		},
+	},
+	{
+		// Revoked tokens are only kept until they would have expired anyway.
+		Version: 8,
+		Name:    "revoked_tokens_expiry_index",
+		Up: func(ctx context.Context, database *mongo.Database) error {
+			return createIndex(ctx, database.Collection("revoked_tokens"), mongo.IndexModel{
+				Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+				Options: options.Index().SetName("expiresAt_1").SetExpireAfterSeconds(0),
+			})
+		},
+		Down: func(ctx context.Context, database *mongo.Database) error {
+			return dropIndex(ctx, database.Collection("revoked_tokens"), "expiresAt_1")
+		},
+	},
+	{
+		// Reviews of a product are paged by createdAt, which the oldest
+		// reviews were written without.
+		Version: 9,
+		Name:    "reviews_created_backfill",
+		Up:      backfillReviewTimes,
+	},
+}
+
+// flattenProducts rewrites products stored before the flat schema, which
+// kept their fields under productview, productcreate and productupdate.
+func flattenProducts(ctx context.Context, database *mongo.Database) error {
+	filter := bson.M{"productview": bson.M{"$exists": true}}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"code":            "$productview.productcreate.code",
+			"name":            "$productview.productcreate.productupdate.name",
+			"origin":          "$productview.productcreate.productupdate.origin",
+			"price":           "$productview.productcreate.productupdate.price",
+			"limit":           "$productview.productcreate.productupdate.limit",
+			"canOrder":        "$productview.productcreate.productupdate.canOrder",
+			"canView":         "$productview.productcreate.productupdate.canView",
+			"ratingSum":       bson.M{"$ifNull": bson.A{"$productview.ratingSum", 0}},
+			"likeCount":       bson.M{"$ifNull": bson.A{"$productview.likeCount", 0}},
+			"reviewCount":     bson.M{"$ifNull": bson.A{"$productview.reviewCount", 0}},
+			"ratingHistogram": bson.M{"$ifNull": bson.A{"$productview.ratingHistogram", bson.M{"$literal": bson.M{}}}},
+		}}},
+		{{Key: "$unset", Value: bson.A{"productview", "productquery"}}},
+	}
+
+	_, err := database.Collection("products").UpdateMany(ctx, filter, update)
+	return err
+}
+
+// flattenReviews moves the fields of reviews stored under reviewordercreate
+// to the top level of the document.
+func flattenReviews(ctx context.Context, database *mongo.Database) error {
+	filter := bson.M{"reviewordercreate": bson.M{"$exists": true}}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"rating":         "$reviewordercreate.rating",
+			"comment":        "$reviewordercreate.comment",
+			"reviewProducts": "$reviewordercreate.reviewProducts",
+		}}},
+		{{Key: "$unset", Value: "reviewordercreate"}},
+	}
+
+	_, err := database.Collection("reviews").UpdateMany(ctx, filter, update)
+	return err
+}
+
+// backfillReviewTimes dates reviews that have no createdAt by the creation
+// time of their ObjectID, in microseconds like every other timestamp.
+func backfillReviewTimes(ctx context.Context, database *mongo.Database) error {
+	filter := bson.M{"createdAt": nil}
+	createdAt := bson.M{"$multiply": bson.A{bson.M{"$toLong": bson.M{"$toDate": "$_id"}}, 1000}}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"createdAt": createdAt,
+			"updatedAt": bson.M{"$ifNull": bson.A{"$updatedAt", createdAt}},
+		}}},
+	}
+
+	_, err := database.Collection("reviews").UpdateMany(ctx, filter, update)
+	return err
+}
+
+// createIndex creates an index, which does nothing if the same index exists.
+func createIndex(ctx context.Context, collection *mongo.Collection, index mongo.IndexModel) error {
+	_, err := collection.Indexes().CreateOne(ctx, index)
+	return err
+}
+
+// dropIndex drops an index by name if it exists.
+func dropIndex(ctx context.Context, collection *mongo.Collection, name string) error {
+	_, err := collection.Indexes().DropOne(ctx, name)
+
+	var commandErr mongo.CommandError
+	if errors.As(err, &commandErr) && (commandErr.Code == codeNamespaceNotFound || commandErr.Code == codeIndexNotFound) {
+		return nil
+	}
+
+	return err
+}
+
+// References
+// https://www.mongodb.com/docs/manual/tutorial/update-documents-with-aggregation-pipeline/
+// https://www.mongodb.com/docs/manual/reference/error-codes/
@@ -1,6 +1,19 @@
 package model
 
+import "time"
+
 type Token struct {
-	UserRole string `json:"userRole" bson:"userRole"`
-	JwtToken string `json:"jwtToken" bson:"jwtToken"`
+	UserRole     string `json:"userRole" bson:"userRole"`
+	JwtToken     string `json:"jwtToken" bson:"jwtToken"`
+	RefreshToken string `json:"refreshToken" bson:"refreshToken"`
+	ExpiresIn    int64  `json:"expiresIn" bson:"expiresIn"`
+}
+
+type RevokedToken struct {
+	ID        string    `json:"id" bson:"_id"`
+	Username  string    `json:"username" bson:"username"`
+	ExpiresAt time.Time `json:"expiresAt" bson:"expiresAt"`
 }
+
+// References
+// https://www.mongodb.com/docs/manual/tutorial/expire-data/
@@ -16,11 +16,55 @@ var OrderStatus = map[string]int{
 	"Cancelled":  6,
 }
 
+// OrderTransitions maps each status to the statuses it may move to and the
+// role allowed to make that move. Delivered and Cancelled are final.
+var OrderTransitions = map[string]map[string]string{
+	"Submitting": {"Submitted": "customer", "Cancelled": "customer"},
+	"Submitted":  {"Cooking": "provider", "Cancelled": "customer"},
+	"Cooking":    {"Cooked": "provider"},
+	"Cooked":     {"Delivering": "provider"},
+	"Delivering": {"Delivered": "provider"},
+	"Delivered":  {},
+	"Cancelled":  {},
+}
+
 type Order struct {
-	CreatedAt int64              `json:"createdAt" bson:"createdAt"`
-	UpdatedAt int64              `json:"updatedAt" bson:"updatedAt"`
-	ID        primitive.ObjectID `json:"id" bson:"_id"`
-	Status    string             `json:"status" bson:"status" binding:"required,oneof=Submitting Submitted Cooking Cooked Delivering Delivered Cancelled"`
-	User      dto.UserCreate     `json:"user" bson:"user"`
-	Cart      map[string]int     `json:"cart" bson:"cart" binding:"required" swaggertype:"object,integer" example:"productCode1:1,productCode2:1"`
+	CreatedAt     int64               `json:"createdAt" bson:"createdAt"`
+	UpdatedAt     int64               `json:"updatedAt" bson:"updatedAt"`
+	ID            primitive.ObjectID  `json:"id" bson:"_id"`
+	Status        string              `json:"status" bson:"status" binding:"required,oneof=Submitting Submitted Cooking Cooked Delivering Delivered Cancelled"`
+	StatusHistory []OrderStatusChange `json:"statusHistory" bson:"statusHistory"`
+	User          dto.UserCreate      `json:"user" bson:"user"`
+	Cart          map[string]int      `json:"cart" bson:"cart" binding:"required" swaggertype:"object,integer" example:"productCode1:1,productCode2:1"`
+	Items         []OrderItem         `json:"items" bson:"items"`
+	Subtotal      float64             `json:"subtotal" bson:"subtotal"`
+	Tax           float64             `json:"tax" bson:"tax"`
+	DeliveryFee   float64             `json:"deliveryFee" bson:"deliveryFee"`
+	Total         float64             `json:"total" bson:"total"`
+}
+
+// OrderItem is a cart line priced when it was added to the order, so that later
+// price changes do not rewrite the order.
+type OrderItem struct {
+	ProductCode string  `json:"productCode" bson:"productCode"`
+	Name        string  `json:"name" bson:"name"`
+	UnitPrice   float64 `json:"unitPrice" bson:"unitPrice"`
+	Quantity    int     `json:"quantity" bson:"quantity"`
+	LineTotal   float64 `json:"lineTotal" bson:"lineTotal"`
+}
+
+type OrderStatusChange struct {
+	Status    string `json:"status" bson:"status"`
+	ChangedAt int64  `json:"changedAt" bson:"changedAt"`
+	Actor     string `json:"actor" bson:"actor"`
+	Note      string `json:"note,omitempty" bson:"note,omitempty"`
+}
+
+// OrderTimeline is the status history of an order with the durations of its
+// stages in seconds, which are omitted until a stage has finished.
+type OrderTimeline struct {
+	Status           string              `json:"status"`
+	History          []OrderStatusChange `json:"history"`
+	PrepDuration     *int64              `json:"prepDuration,omitempty"`
+	DeliveryDuration *int64              `json:"deliveryDuration,omitempty"`
 }
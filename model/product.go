@@ -3,15 +3,106 @@ package model
 import "oos/dto"
 
 type Product struct {
-	CreatedAt  int64          `json:"createdAt" bson:"createdAt"`
-	UpdatedAt  int64          `json:"updatedAt" bson:"updatedAt"`
-	UserOrders map[string]int `json:"userOrders" bson:"userOrders"`
+	CreatedAt    int64          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt    int64          `json:"updatedAt" bson:"updatedAt"`
+	UserOrders   map[string]int `json:"userOrders" bson:"userOrders"`
+	Stock        int            `json:"stock" bson:"stock"`
+	SoldOut      bool           `json:"soldOut" bson:"soldOut"`
+	StockResetAt int64          `json:"stockResetAt" bson:"stockResetAt"`
 	ProductView
 }
 
+// ProductStock is the remaining stock of a product in the current period,
+// which is refilled to Limit on every reset.
+type ProductStock struct {
+	Code         string `json:"code"`
+	Limit        int    `json:"limit"`
+	Stock        int    `json:"stock"`
+	SoldOut      bool   `json:"soldOut"`
+	CanOrder     bool   `json:"canOrder"`
+	StockResetAt int64  `json:"stockResetAt"`
+}
+
 type ProductView struct {
 	RatingSum   float32 `json:"ratingSum" bson:"ratingSum"`
 	LikeCount   int     `json:"likeCount" bson:"likeCount"`
 	ReviewCount int     `json:"reviewCount" bson:"reviewCount"`
+	// RatingHistogram counts reviews by star, keyed "1" to "5".
+	RatingHistogram map[string]int `json:"ratingHistogram" bson:"ratingHistogram" swaggertype:"object,integer" example:"1:0,2:0,3:1,4:2,5:4"`
 	dto.ProductCreate
 }
+
+// ProductDocument is how a product is stored in the products collection. Its
+// fields are flat and tagged one by one so that query paths are the same as
+// the field names below; Product and ProductView are only returned to clients.
+type ProductDocument struct {
+	CreatedAt       int64          `bson:"createdAt"`
+	UpdatedAt       int64          `bson:"updatedAt"`
+	Code            string         `bson:"code"`
+	Name            string         `bson:"name"`
+	Origin          string         `bson:"origin"`
+	Price           float64        `bson:"price"`
+	Limit           int            `bson:"limit"`
+	CanOrder        bool           `bson:"canOrder"`
+	CanView         bool           `bson:"canView"`
+	Stock           int            `bson:"stock"`
+	SoldOut         bool           `bson:"soldOut"`
+	StockResetAt    int64          `bson:"stockResetAt"`
+	UserOrders      map[string]int `bson:"userOrders"`
+	RatingSum       float64        `bson:"ratingSum"`
+	LikeCount       int            `bson:"likeCount"`
+	ReviewCount     int            `bson:"reviewCount"`
+	RatingHistogram map[string]int `bson:"ratingHistogram"`
+}
+
+// NewProductDocument stores a new product, which starts visible with a full
+// stock.
+func NewProductDocument(params dto.ProductCreate, now int64) ProductDocument {
+	return ProductDocument{
+		CreatedAt:       now,
+		UpdatedAt:       now,
+		Code:            params.Code,
+		Name:            params.Name,
+		Origin:          params.Origin,
+		Price:           params.Price,
+		Limit:           params.Limit,
+		CanOrder:        params.CanOrder,
+		CanView:         true,
+		Stock:           params.Limit,
+		StockResetAt:    now,
+		UserOrders:      map[string]int{},
+		RatingHistogram: map[string]int{},
+	}
+}
+
+func (d ProductDocument) Product() Product {
+	return Product{
+		CreatedAt:    d.CreatedAt,
+		UpdatedAt:    d.UpdatedAt,
+		UserOrders:   d.UserOrders,
+		Stock:        d.Stock,
+		SoldOut:      d.SoldOut,
+		StockResetAt: d.StockResetAt,
+		ProductView:  d.View(),
+	}
+}
+
+func (d ProductDocument) View() ProductView {
+	return ProductView{
+		RatingSum:       float32(d.RatingSum),
+		LikeCount:       d.LikeCount,
+		ReviewCount:     d.ReviewCount,
+		RatingHistogram: d.RatingHistogram,
+		ProductCreate: dto.ProductCreate{
+			Code: d.Code,
+			ProductUpdate: dto.ProductUpdate{
+				Name:     d.Name,
+				Origin:   d.Origin,
+				Price:    d.Price,
+				Limit:    d.Limit,
+				CanOrder: d.CanOrder,
+				CanView:  d.CanView,
+			},
+		},
+	}
+}
@@ -3,9 +3,12 @@ package model
 import "oos/dto"
 
 type ReviewOrder struct {
-	OrderID  string `json:"orderID" bson:"orderID"`
-	Username string `json:"username" bson:"username"`
-	dto.ReviewOrderCreate
+	CreatedAt             int64  `json:"createdAt" bson:"createdAt"`
+	UpdatedAt             int64  `json:"updatedAt" bson:"updatedAt"`
+	OrderID               string `json:"orderID" bson:"orderID"`
+	Username              string `json:"username" bson:"username"`
+	Hidden                bool   `json:"hidden" bson:"hidden"`
+	dto.ReviewOrderCreate `bson:",inline"`
 }
 
 type ReviewProduct struct {
@@ -13,9 +16,10 @@ type ReviewProduct struct {
 }
 
 type ReviewView struct {
-	Username string  `json:"username" bson:"username"`
-	Rating   float64 `json:"rating" bson:"rating"`
-	dto.ReviewProductCreate
+	CreatedAt               int64   `json:"createdAt" bson:"createdAt"`
+	Username                string  `json:"username" bson:"username"`
+	Rating                  float64 `json:"rating" bson:"rating"`
+	dto.ReviewProductCreate `bson:"reviewProduct"`
 }
 
 // References
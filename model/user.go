@@ -3,7 +3,21 @@ package model
 import "oos/dto"
 
 type User struct {
-	dto.UserCreate
+	CreatedAt      int64    `json:"createdAt" bson:"createdAt"`
+	UpdatedAt      int64    `json:"updatedAt" bson:"updatedAt"`
+	PasswordHash   []byte   `json:"-" bson:"passwordHash"`
+	Roles          []string `json:"roles" bson:"roles"`
+	dto.UserCreate `bson:",inline"`
+}
+
+func (u User) HasRole(role string) bool {
+	for i := range u.Roles {
+		if u.Roles[i] == role {
+			return true
+		}
+	}
+
+	return false
 }
 
 type Address struct {
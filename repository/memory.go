@@ -0,0 +1,763 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"oos/dto"
+	"oos/model"
+)
+
+// NewMemory returns repositories that keep everything in memory, for running
+// the services without a database. They are safe for concurrent use.
+func NewMemory() Repositories {
+	store := &memoryStore{
+		products: map[string]model.ProductDocument{},
+		orders:   map[string]model.Order{},
+		reviews:  map[string]model.ReviewOrder{},
+		users:    map[string]model.User{},
+		tokens:   map[string]time.Time{},
+	}
+
+	return Repositories{
+		Products:     &memoryProducts{store: store},
+		Orders:       &memoryOrders{store: store},
+		Reviews:      &memoryReviews{store: store},
+		Users:        &memoryUsers{store: store},
+		Tokens:       &memoryTokens{store: store},
+		Transactions: &memoryTransactor{store: store},
+	}
+}
+
+// memoryStore holds the documents of every repository. Documents are copied
+// in and out through BSON so that callers never share them with the store.
+type memoryStore struct {
+	mu       sync.Mutex
+	products map[string]model.ProductDocument
+	orders   map[string]model.Order
+	reviews  map[string]model.ReviewOrder
+	users    map[string]model.User
+	tokens   map[string]time.Time
+}
+
+type memoryTxKey struct{}
+
+// lock locks the store unless ctx belongs to a transaction, which holds the
+// lock until it ends.
+func (s *memoryStore) lock(ctx context.Context) func() {
+	if ctx.Value(memoryTxKey{}) == s {
+		return func() {}
+	}
+	s.mu.Lock()
+	return s.mu.Unlock
+}
+
+func copyDocument(src interface{}, dst interface{}) {
+	b, err := bson.Marshal(src)
+	if err != nil {
+		panic(err)
+	}
+	if err := bson.Unmarshal(b, dst); err != nil {
+		panic(err)
+	}
+}
+
+type memoryTransactor struct {
+	store *memoryStore
+}
+
+// WithTransaction runs fn with the store locked, and puts back the products,
+// orders and reviews the store held before if fn fails. A transaction started
+// inside fn joins it.
+func (t *memoryTransactor) WithTransaction(ctx context.Context, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	s := t.store
+	if ctx.Value(memoryTxKey{}) == s {
+		return fn(ctx)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Stored documents are replaced rather than changed in place, so copying
+	// the maps is enough to keep the snapshot intact.
+	products, orders, reviews := s.products, s.orders, s.reviews
+	s.products = map[string]model.ProductDocument{}
+	for code, product := range products {
+		s.products[code] = product
+	}
+	s.orders = map[string]model.Order{}
+	for id, order := range orders {
+		s.orders[id] = order
+	}
+	s.reviews = map[string]model.ReviewOrder{}
+	for orderID, review := range reviews {
+		s.reviews[orderID] = review
+	}
+
+	result, err := fn(context.WithValue(ctx, memoryTxKey{}, s))
+	if err != nil {
+		s.products, s.orders, s.reviews = products, orders, reviews
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// memoryPage returns the bounds of the page after query.Cursor in n sorted
+// items. The cursor is the offset of the page, so pages shift when items are
+// added or removed between requests.
+func memoryPage(n int, query dto.PageQuery) (start int, end int, page dto.Page, err error) {
+	limit := query.Limit
+	if limit <= 0 {
+		limit = defaultPageLimit
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+
+	if query.Cursor != "" {
+		b, err := base64.RawURLEncoding.DecodeString(query.Cursor)
+		if err != nil {
+			return 0, 0, page, ErrInvalidCursor
+		}
+		start, err = strconv.Atoi(string(b))
+		if err != nil || start < 0 {
+			return 0, 0, page, ErrInvalidCursor
+		}
+	}
+	if start > n {
+		start = n
+	}
+	end = start + limit
+	if end < n {
+		page.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(end)))
+	} else {
+		end = n
+	}
+
+	if query.Total {
+		total := int64(n)
+		page.Total = &total
+	}
+
+	return start, end, page, nil
+}
+
+type memoryProducts struct {
+	store *memoryStore
+}
+
+func (r *memoryProducts) Insert(ctx context.Context, product model.ProductDocument) (*mongo.InsertOneResult, error) {
+	defer r.store.lock(ctx)()
+
+	if _, ok := r.store.products[product.Code]; ok {
+		return nil, ErrDuplicate
+	}
+	var stored model.ProductDocument
+	copyDocument(product, &stored)
+	r.store.products[product.Code] = stored
+
+	return &mongo.InsertOneResult{InsertedID: primitive.NewObjectID()}, nil
+}
+
+func (r *memoryProducts) Get(ctx context.Context, code string) (*model.ProductDocument, error) {
+	defer r.store.lock(ctx)()
+
+	stored, ok := r.store.products[code]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	var product model.ProductDocument
+	copyDocument(stored, &product)
+
+	return &product, nil
+}
+
+func (r *memoryProducts) FindByCodes(ctx context.Context, codes []string) ([]model.ProductDocument, error) {
+	defer r.store.lock(ctx)()
+
+	var products []model.ProductDocument
+	for _, code := range codes {
+		if stored, ok := r.store.products[code]; ok {
+			var product model.ProductDocument
+			copyDocument(stored, &product)
+			products = append(products, product)
+		}
+	}
+
+	return products, nil
+}
+
+// productSortKey computes the fields products are listed by, as the Mongo
+// implementation does.
+func productSortKey(product model.ProductDocument, key string) float64 {
+	switch key {
+	case "ratings":
+		if product.ReviewCount > 0 {
+			return product.RatingSum / float64(product.ReviewCount)
+		}
+		return 0
+	case "reorders":
+		reorders := 0
+		for _, orders := range product.UserOrders {
+			if orders > 1 {
+				reorders += orders - 1
+			}
+		}
+		return float64(reorders)
+	case "likes":
+		return float64(product.LikeCount)
+	default:
+		return float64(product.CreatedAt)
+	}
+}
+
+func (r *memoryProducts) List(ctx context.Context, query dto.ProductQuery) (*dto.Page, error) {
+	defer r.store.lock(ctx)()
+
+	var products []model.ProductDocument
+	for _, product := range r.store.products {
+		if !product.CanView {
+			continue
+		}
+		if query.Orderable && (!product.CanOrder || product.SoldOut) {
+			continue
+		}
+		products = append(products, product)
+	}
+
+	keys := []string{query.Sort}
+	if query.Then != "" {
+		keys = append(keys, query.Then)
+	}
+	sort.Slice(products, func(i, j int) bool {
+		for _, key := range keys {
+			a, b := productSortKey(products[i], key), productSortKey(products[j], key)
+			if a != b {
+				if query.Order == "asc" {
+					return a < b
+				}
+				return a > b
+			}
+		}
+		return products[i].Code < products[j].Code
+	})
+
+	start, end, page, err := memoryPage(len(products), query.PageQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	views := []model.ProductView{}
+	for _, stored := range products[start:end] {
+		var product model.ProductDocument
+		copyDocument(stored, &product)
+		views = append(views, product.View())
+	}
+	page.Items = views
+
+	return &page, nil
+}
+
+// update applies fn to the stored product with code, failing if there is none.
+func (r *memoryProducts) update(ctx context.Context, code string, fn func(product *model.ProductDocument)) (*mongo.UpdateResult, error) {
+	defer r.store.lock(ctx)()
+
+	stored, ok := r.store.products[code]
+	if !ok {
+		return nil, errors.New("no match to update")
+	}
+	var product model.ProductDocument
+	copyDocument(stored, &product)
+	fn(&product)
+	r.store.products[code] = product
+
+	return &mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil
+}
+
+func (r *memoryProducts) Update(ctx context.Context, code string, params dto.ProductUpdate, updatedAt int64) (*mongo.UpdateResult, error) {
+	return r.update(ctx, code, func(product *model.ProductDocument) {
+		product.Name = params.Name
+		product.Origin = params.Origin
+		product.Price = params.Price
+		product.Limit = params.Limit
+		product.CanOrder = params.CanOrder
+		product.CanView = params.CanView
+		product.UpdatedAt = updatedAt
+	})
+}
+
+func (r *memoryProducts) Hide(ctx context.Context, code string, updatedAt int64) (*mongo.UpdateResult, error) {
+	return r.update(ctx, code, func(product *model.ProductDocument) {
+		product.CanView = false
+		product.UpdatedAt = updatedAt
+	})
+}
+
+func (r *memoryProducts) Reserve(ctx context.Context, code string, quantity int) (bool, error) {
+	defer r.store.lock(ctx)()
+
+	product, ok := r.store.products[code]
+	if !ok || !product.CanOrder || product.Stock < quantity {
+		return false, nil
+	}
+	product.Stock -= quantity
+	r.store.products[code] = product
+
+	return true, nil
+}
+
+func (r *memoryProducts) Release(ctx context.Context, code string, quantity int) error {
+	defer r.store.lock(ctx)()
+
+	if product, ok := r.store.products[code]; ok && product.Stock < product.Limit {
+		product.Stock += quantity
+		if product.Stock > product.Limit {
+			product.Stock = product.Limit
+		}
+		r.store.products[code] = product
+	}
+
+	return nil
+}
+
+func (r *memoryProducts) MarkSoldOut(ctx context.Context, code string) error {
+	defer r.store.lock(ctx)()
+
+	if product, ok := r.store.products[code]; ok && product.Stock <= 0 {
+		product.SoldOut = true
+		product.CanOrder = false
+		r.store.products[code] = product
+	}
+
+	return nil
+}
+
+func (r *memoryProducts) Reopen(ctx context.Context, code string) error {
+	defer r.store.lock(ctx)()
+
+	if product, ok := r.store.products[code]; ok && product.SoldOut && product.Stock > 0 {
+		product.SoldOut = false
+		product.CanOrder = true
+		r.store.products[code] = product
+	}
+
+	return nil
+}
+
+func (r *memoryProducts) SetStock(ctx context.Context, code string, stock int, soldOut *bool, updatedAt int64) (*mongo.UpdateResult, error) {
+	return r.update(ctx, code, func(product *model.ProductDocument) {
+		product.Stock = stock
+		product.UpdatedAt = updatedAt
+		if soldOut != nil {
+			product.SoldOut = *soldOut
+			product.CanOrder = !*soldOut
+		}
+	})
+}
+
+func (r *memoryProducts) ResetStock(ctx context.Context, resetAt int64) (*mongo.UpdateResult, error) {
+	defer r.store.lock(ctx)()
+
+	var count int64
+	for code, product := range r.store.products {
+		if product.StockResetAt >= resetAt {
+			continue
+		}
+		product.Stock = product.Limit
+		product.StockResetAt = resetAt
+		if product.SoldOut {
+			product.CanOrder = true
+		}
+		product.SoldOut = false
+		r.store.products[code] = product
+		count++
+	}
+
+	return &mongo.UpdateResult{MatchedCount: count, ModifiedCount: count}, nil
+}
+
+func (r *memoryProducts) CountReview(ctx context.Context, code string, count ReviewCount) error {
+	like := 0
+	if count.Liked {
+		like = 1
+	}
+
+	_, err := r.update(ctx, code, func(product *model.ProductDocument) {
+		if product.UserOrders == nil {
+			product.UserOrders = map[string]int{}
+		}
+		if product.RatingHistogram == nil {
+			product.RatingHistogram = map[string]int{}
+		}
+		product.UserOrders[count.Username] += count.Sign
+		product.ReviewCount += count.Sign
+		product.RatingSum += float64(count.Sign) * count.Rating
+		product.LikeCount += count.Sign * like
+		product.RatingHistogram[count.Star] += count.Sign
+	})
+	return err
+}
+
+type memoryOrders struct {
+	store *memoryStore
+}
+
+func (r *memoryOrders) Insert(ctx context.Context, order model.Order) (*mongo.InsertOneResult, error) {
+	defer r.store.lock(ctx)()
+
+	if _, ok := r.store.orders[order.ID.Hex()]; ok {
+		return nil, ErrDuplicate
+	}
+	var stored model.Order
+	copyDocument(order, &stored)
+	r.store.orders[order.ID.Hex()] = stored
+
+	return &mongo.InsertOneResult{InsertedID: order.ID}, nil
+}
+
+func (r *memoryOrders) Get(ctx context.Context, id string) (*model.Order, error) {
+	defer r.store.lock(ctx)()
+
+	orderID, _ := primitive.ObjectIDFromHex(id)
+	stored, ok := r.store.orders[orderID.Hex()]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	var order model.Order
+	copyDocument(stored, &order)
+
+	return &order, nil
+}
+
+func (r *memoryOrders) List(ctx context.Context, filter OrderFilter, query dto.PageQuery) (*dto.Page, error) {
+	defer r.store.lock(ctx)()
+
+	var orders []model.Order
+	for _, order := range r.store.orders {
+		if filter.Username != "" && order.User.Username != filter.Username {
+			continue
+		}
+		if len(filter.Statuses) > 0 && !containsString(filter.Statuses, order.Status) {
+			continue
+		}
+		if containsString(filter.ExcludeStatuses, order.Status) {
+			continue
+		}
+		if filter.CreatedFrom != 0 && order.CreatedAt < filter.CreatedFrom {
+			continue
+		}
+		if filter.CreatedTo != 0 && order.CreatedAt >= filter.CreatedTo {
+			continue
+		}
+		orders = append(orders, order)
+	}
+	sort.Slice(orders, func(i, j int) bool {
+		if orders[i].CreatedAt != orders[j].CreatedAt {
+			return orders[i].CreatedAt < orders[j].CreatedAt
+		}
+		return orders[i].ID.Hex() < orders[j].ID.Hex()
+	})
+
+	start, end, page, err := memoryPage(len(orders), query)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []model.Order{}
+	for _, stored := range orders[start:end] {
+		var order model.Order
+		copyDocument(stored, &order)
+		items = append(items, order)
+	}
+	page.Items = items
+
+	return &page, nil
+}
+
+func (r *memoryOrders) update(ctx context.Context, id primitive.ObjectID, fn func(order *model.Order)) (*mongo.UpdateResult, error) {
+	defer r.store.lock(ctx)()
+
+	stored, ok := r.store.orders[id.Hex()]
+	if !ok {
+		return nil, errors.New("no match to update")
+	}
+	var order model.Order
+	copyDocument(stored, &order)
+	fn(&order)
+	var updated model.Order
+	copyDocument(order, &updated)
+	r.store.orders[id.Hex()] = updated
+
+	return &mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil
+}
+
+func (r *memoryOrders) UpdateStatus(ctx context.Context, id string, change model.OrderStatusChange) (*mongo.UpdateResult, error) {
+	orderID, _ := primitive.ObjectIDFromHex(id)
+
+	return r.update(ctx, orderID, func(order *model.Order) {
+		order.Status = change.Status
+		order.UpdatedAt = change.ChangedAt
+		order.StatusHistory = append(order.StatusHistory, change)
+	})
+}
+
+func (r *memoryOrders) UpdateCart(ctx context.Context, order model.Order, updatedAt int64) (*mongo.UpdateResult, error) {
+	return r.update(ctx, order.ID, func(stored *model.Order) {
+		stored.Cart = order.Cart
+		stored.Items = order.Items
+		stored.Subtotal = order.Subtotal
+		stored.Tax = order.Tax
+		stored.DeliveryFee = order.DeliveryFee
+		stored.Total = order.Total
+		stored.UpdatedAt = updatedAt
+	})
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+type memoryReviews struct {
+	store *memoryStore
+}
+
+func (r *memoryReviews) Insert(ctx context.Context, review model.ReviewOrder) (*mongo.InsertOneResult, error) {
+	defer r.store.lock(ctx)()
+
+	if _, ok := r.store.reviews[review.OrderID]; ok {
+		return nil, ErrDuplicate
+	}
+	var stored model.ReviewOrder
+	copyDocument(review, &stored)
+	r.store.reviews[review.OrderID] = stored
+
+	return &mongo.InsertOneResult{InsertedID: primitive.NewObjectID()}, nil
+}
+
+func (r *memoryReviews) Get(ctx context.Context, orderID string) (*model.ReviewOrder, error) {
+	defer r.store.lock(ctx)()
+
+	stored, ok := r.store.reviews[orderID]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	var review model.ReviewOrder
+	copyDocument(stored, &review)
+
+	return &review, nil
+}
+
+func (r *memoryReviews) Replace(ctx context.Context, review model.ReviewOrder) (*mongo.UpdateResult, error) {
+	defer r.store.lock(ctx)()
+
+	if _, ok := r.store.reviews[review.OrderID]; !ok {
+		return nil, errors.New("no match to update")
+	}
+	var stored model.ReviewOrder
+	copyDocument(review, &stored)
+	r.store.reviews[review.OrderID] = stored
+
+	return &mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil
+}
+
+func (r *memoryReviews) Delete(ctx context.Context, orderID string) (*mongo.DeleteResult, error) {
+	defer r.store.lock(ctx)()
+
+	if _, ok := r.store.reviews[orderID]; !ok {
+		return nil, errors.New("no match to delete")
+	}
+	delete(r.store.reviews, orderID)
+
+	return &mongo.DeleteResult{DeletedCount: 1}, nil
+}
+
+func (r *memoryReviews) SetHidden(ctx context.Context, orderID string, hidden bool) (*mongo.UpdateResult, error) {
+	defer r.store.lock(ctx)()
+
+	review, ok := r.store.reviews[orderID]
+	if !ok || review.Hidden == hidden {
+		return &mongo.UpdateResult{}, nil
+	}
+	review.Hidden = hidden
+	r.store.reviews[orderID] = review
+
+	return &mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil
+}
+
+func (r *memoryReviews) List(ctx context.Context, query dto.PageQuery) (*dto.Page, error) {
+	defer r.store.lock(ctx)()
+
+	orderIDs := make([]string, 0, len(r.store.reviews))
+	for orderID := range r.store.reviews {
+		orderIDs = append(orderIDs, orderID)
+	}
+	sort.Strings(orderIDs)
+
+	start, end, page, err := memoryPage(len(orderIDs), query)
+	if err != nil {
+		return nil, err
+	}
+
+	reviews := []model.ReviewOrder{}
+	for _, orderID := range orderIDs[start:end] {
+		var review model.ReviewOrder
+		copyDocument(r.store.reviews[orderID], &review)
+		reviews = append(reviews, review)
+	}
+	page.Items = reviews
+
+	return &page, nil
+}
+
+func (r *memoryReviews) ListByProduct(ctx context.Context, code string, query dto.ReviewQuery) (*dto.Page, error) {
+	defer r.store.lock(ctx)()
+
+	type line struct {
+		orderID string
+		view    model.ReviewView
+	}
+	var lines []line
+	for orderID, review := range r.store.reviews {
+		if review.Hidden {
+			continue
+		}
+		for _, reviewProduct := range review.ReviewProducts {
+			if reviewProduct.ProductCode != code {
+				continue
+			}
+			if query.WithComment && reviewProduct.Comment == "" {
+				continue
+			}
+			// A product rating overrides the rating of the whole order.
+			rating := review.Rating
+			if reviewProduct.Rating > 0 {
+				rating = float64(reviewProduct.Rating)
+			}
+			lines = append(lines, line{orderID: orderID, view: model.ReviewView{
+				CreatedAt:           review.CreatedAt,
+				Username:            review.Username,
+				Rating:              rating,
+				ReviewProductCreate: reviewProduct,
+			}})
+		}
+	}
+	sort.Slice(lines, func(i, j int) bool {
+		a, b := lines[i].view, lines[j].view
+		if a.Rating != b.Rating {
+			switch query.Sort {
+			case "highest":
+				return a.Rating > b.Rating
+			case "lowest":
+				return a.Rating < b.Rating
+			}
+		}
+		if a.CreatedAt != b.CreatedAt {
+			return a.CreatedAt > b.CreatedAt
+		}
+		return lines[i].orderID < lines[j].orderID
+	})
+
+	start, end, page, err := memoryPage(len(lines), query.PageQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	reviews := []model.ReviewView{}
+	for _, l := range lines[start:end] {
+		reviews = append(reviews, l.view)
+	}
+	page.Items = reviews
+
+	return &page, nil
+}
+
+type memoryUsers struct {
+	store *memoryStore
+}
+
+func (r *memoryUsers) Insert(ctx context.Context, user model.User) (*mongo.InsertOneResult, error) {
+	defer r.store.lock(ctx)()
+
+	if _, ok := r.store.users[user.Username]; ok {
+		return nil, ErrDuplicate
+	}
+	var stored model.User
+	copyDocument(user, &stored)
+	r.store.users[user.Username] = stored
+
+	return &mongo.InsertOneResult{InsertedID: primitive.NewObjectID()}, nil
+}
+
+func (r *memoryUsers) Get(ctx context.Context, username string) (*model.User, error) {
+	defer r.store.lock(ctx)()
+
+	stored, ok := r.store.users[username]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	var user model.User
+	copyDocument(stored, &user)
+
+	return &user, nil
+}
+
+func (r *memoryUsers) AddRole(ctx context.Context, username string, role string) (*mongo.UpdateResult, error) {
+	defer r.store.lock(ctx)()
+
+	stored, ok := r.store.users[username]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	if stored.HasRole(role) {
+		return &mongo.UpdateResult{MatchedCount: 1}, nil
+	}
+	var user model.User
+	copyDocument(stored, &user)
+	user.Roles = append(user.Roles, role)
+	user.UpdatedAt = time.Now().UnixMicro()
+	r.store.users[username] = user
+
+	return &mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil
+}
+
+type memoryTokens struct {
+	store *memoryStore
+}
+
+func (r *memoryTokens) Revoke(ctx context.Context, tokenID string, username string, expiresAt time.Time) error {
+	defer r.store.lock(ctx)()
+
+	if _, ok := r.store.tokens[tokenID]; !ok {
+		r.store.tokens[tokenID] = expiresAt
+	}
+
+	return nil
+}
+
+// IsRevoked forgets tokens that have expired, as the TTL index does in Mongo.
+func (r *memoryTokens) IsRevoked(ctx context.Context, tokenID string) (bool, error) {
+	defer r.store.lock(ctx)()
+
+	expiresAt, ok := r.store.tokens[tokenID]
+	if ok && time.Now().After(expiresAt) {
+		delete(r.store.tokens, tokenID)
+		return false, nil
+	}
+
+	return ok, nil
+}
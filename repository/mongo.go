@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+// NewMongo returns repositories backed by the collections of database.
+func NewMongo(database *mongo.Database) Repositories {
+	return Repositories{
+		Products:     &mongoProducts{collection: database.Collection("products")},
+		Orders:       &mongoOrders{collection: database.Collection("orders")},
+		Reviews:      &mongoReviews{collection: database.Collection("reviews")},
+		Users:        &mongoUsers{collection: database.Collection("users")},
+		Tokens:       &mongoTokens{collection: database.Collection("revoked_tokens")},
+		Transactions: &mongoTransactor{client: database.Client()},
+	}
+}
+
+type mongoTransactor struct {
+	client *mongo.Client
+}
+
+// WithTransaction runs fn in a transaction on a new session. The driver
+// retries fn on transient errors and the commit on unknown commit results.
+func (t *mongoTransactor) WithTransaction(ctx context.Context, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	session, err := t.client.StartSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.EndSession(ctx)
+
+	opts := options.Transaction().
+		SetReadConcern(readconcern.Snapshot()).
+		SetWriteConcern(writeconcern.New(writeconcern.WMajority()))
+
+	return session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		return fn(sessCtx)
+	}, opts)
+}
+
+// References
+// https://www.mongodb.com/docs/drivers/go/current/fundamentals/transactions/
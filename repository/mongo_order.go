@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"oos/dto"
+	"oos/model"
+)
+
+type mongoOrders struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoOrders) Insert(ctx context.Context, order model.Order) (*mongo.InsertOneResult, error) {
+	return r.collection.InsertOne(ctx, order)
+}
+
+func (r *mongoOrders) Get(ctx context.Context, id string) (*model.Order, error) {
+	orderID, _ := primitive.ObjectIDFromHex(id)
+	filter := bson.M{"_id": orderID}
+
+	var order model.Order
+	if err := r.collection.FindOne(ctx, filter).Decode(&order); err != nil {
+		return nil, err
+	}
+
+	return &order, nil
+}
+
+func (r *mongoOrders) List(ctx context.Context, filter OrderFilter, query dto.PageQuery) (*dto.Page, error) {
+	match := bson.M{}
+	if filter.Username != "" {
+		match["user.username"] = filter.Username
+	}
+	status := bson.M{}
+	if len(filter.Statuses) > 0 {
+		status["$in"] = filter.Statuses
+	}
+	if len(filter.ExcludeStatuses) > 0 {
+		status["$nin"] = filter.ExcludeStatuses
+	}
+	if len(status) > 0 {
+		match["status"] = status
+	}
+	createdAt := bson.M{}
+	if filter.CreatedFrom != 0 {
+		createdAt["$gte"] = filter.CreatedFrom
+	}
+	if filter.CreatedTo != 0 {
+		createdAt["$lt"] = filter.CreatedTo
+	}
+	if len(createdAt) > 0 {
+		match["createdAt"] = createdAt
+	}
+
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: match}}}
+	sort := bson.D{{Key: "createdAt", Value: 1}}
+
+	page, err := paginate(ctx, r.collection, pipeline, sort, query)
+	if err != nil {
+		return nil, err
+	}
+
+	orders := []model.Order{}
+	for _, doc := range page.docs {
+		var order model.Order
+		if err := bson.Unmarshal(doc, &order); err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+
+	return &dto.Page{Items: orders, NextCursor: page.nextCursor, Total: page.total}, nil
+}
+
+func (r *mongoOrders) UpdateStatus(ctx context.Context, id string, change model.OrderStatusChange) (*mongo.UpdateResult, error) {
+	orderID, _ := primitive.ObjectIDFromHex(id)
+	filter := bson.M{"_id": orderID}
+	update := bson.M{
+		"$set": bson.M{
+			"status":    change.Status,
+			"updatedAt": change.ChangedAt,
+		},
+		"$push": bson.M{"statusHistory": change},
+	}
+
+	return r.updateOne(ctx, filter, update)
+}
+
+func (r *mongoOrders) UpdateCart(ctx context.Context, order model.Order, updatedAt int64) (*mongo.UpdateResult, error) {
+	filter := bson.M{"_id": order.ID}
+	update := bson.M{"$set": bson.M{
+		"cart":        order.Cart,
+		"items":       order.Items,
+		"subtotal":    order.Subtotal,
+		"tax":         order.Tax,
+		"deliveryFee": order.DeliveryFee,
+		"total":       order.Total,
+		"updatedAt":   updatedAt,
+	}}
+
+	return r.updateOne(ctx, filter, update)
+}
+
+func (r *mongoOrders) updateOne(ctx context.Context, filter interface{}, update interface{}) (*mongo.UpdateResult, error) {
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount != 1 {
+		return nil, errors.New("no match to update")
+	}
+
+	return result, nil
+}
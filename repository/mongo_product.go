@@ -0,0 +1,261 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"oos/dto"
+	"oos/model"
+)
+
+type mongoProducts struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoProducts) Insert(ctx context.Context, product model.ProductDocument) (*mongo.InsertOneResult, error) {
+	result, err := r.collection.InsertOne(ctx, product)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrDuplicate
+	}
+
+	return result, err
+}
+
+func (r *mongoProducts) Get(ctx context.Context, code string) (*model.ProductDocument, error) {
+	filter := bson.M{"code": code}
+
+	var product model.ProductDocument
+	if err := r.collection.FindOne(ctx, filter).Decode(&product); err != nil {
+		return nil, err
+	}
+
+	return &product, nil
+}
+
+func (r *mongoProducts) FindByCodes(ctx context.Context, codes []string) ([]model.ProductDocument, error) {
+	filter := bson.M{"code": bson.M{"$in": codes}}
+
+	cursor, err := r.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var products []model.ProductDocument
+	for cursor.Next(ctx) {
+		var product model.ProductDocument
+		if err := cursor.Decode(&product); err != nil {
+			return nil, err
+		}
+		products = append(products, product)
+	}
+
+	return products, cursor.Err()
+}
+
+// List sorts products by one of the computed fields below, which query.Sort
+// must name, and then by another if given.
+func (r *mongoProducts) List(ctx context.Context, query dto.ProductQuery) (*dto.Page, error) {
+	filter := bson.M{"canView": true}
+	if query.Orderable {
+		filter["canOrder"] = true
+		filter["soldOut"] = bson.M{"$ne": true}
+	}
+	matchStage := bson.D{{Key: "$match", Value: filter}}
+
+	setStage := bson.D{{Key: "$set", Value: bson.M{
+		// Average rating, 0 until the product is reviewed.
+		"ratings": bson.M{"$cond": bson.A{
+			bson.M{"$gt": bson.A{"$reviewCount", 0}},
+			bson.M{"$divide": bson.A{"$ratingSum", "$reviewCount"}},
+			0,
+		}},
+		// Orders after the first one of each customer.
+		"reorders": bson.M{"$reduce": bson.M{
+			"input":        bson.M{"$objectToArray": bson.M{"$ifNull": bson.A{"$userOrders", bson.M{}}}},
+			"initialValue": 0,
+			"in": bson.M{"$add": bson.A{
+				"$$value",
+				bson.M{"$max": bson.A{bson.M{"$subtract": bson.A{"$$this.v", 1}}, 0}},
+			}},
+		}},
+		"likes": bson.M{"$ifNull": bson.A{"$likeCount", 0}},
+		"time":  "$createdAt",
+	}}}
+
+	direction := -1
+	if query.Order == "asc" {
+		direction = 1
+	}
+	sort := bson.D{{Key: query.Sort, Value: direction}}
+	if query.Then != "" {
+		sort = append(sort, bson.E{Key: query.Then, Value: direction})
+	}
+
+	page, err := paginate(ctx, r.collection, mongo.Pipeline{matchStage, setStage}, sort, query.PageQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	products := []model.ProductView{}
+	for _, doc := range page.docs {
+		var product model.ProductDocument
+		if err := bson.Unmarshal(doc, &product); err != nil {
+			return nil, err
+		}
+		products = append(products, product.View())
+	}
+
+	return &dto.Page{Items: products, NextCursor: page.nextCursor, Total: page.total}, nil
+}
+
+func (r *mongoProducts) Update(ctx context.Context, code string, params dto.ProductUpdate, updatedAt int64) (*mongo.UpdateResult, error) {
+	filter := bson.M{"code": code}
+	update := bson.M{"$set": bson.M{
+		"name":      params.Name,
+		"origin":    params.Origin,
+		"price":     params.Price,
+		"limit":     params.Limit,
+		"canOrder":  params.CanOrder,
+		"canView":   params.CanView,
+		"updatedAt": updatedAt,
+	}}
+
+	return r.updateOne(ctx, filter, update)
+}
+
+func (r *mongoProducts) Hide(ctx context.Context, code string, updatedAt int64) (*mongo.UpdateResult, error) {
+	filter := bson.M{"code": code}
+	update := bson.M{"$set": bson.M{
+		"canView":   false,
+		"updatedAt": updatedAt,
+	}}
+
+	return r.updateOne(ctx, filter, update)
+}
+
+func (r *mongoProducts) Reserve(ctx context.Context, code string, quantity int) (bool, error) {
+	filter := bson.M{
+		"code":     code,
+		"canOrder": true,
+		"stock":    bson.M{"$gte": quantity},
+	}
+	update := bson.M{"$inc": bson.M{"stock": -quantity}}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+
+	return result.MatchedCount == 1, nil
+}
+
+func (r *mongoProducts) Release(ctx context.Context, code string, quantity int) error {
+	filter := bson.M{"code": code}
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"stock": bson.M{"$max": bson.A{
+			"$stock",
+			bson.M{"$min": bson.A{"$limit", bson.M{"$add": bson.A{"$stock", quantity}}}},
+		}},
+	}}}}
+
+	_, err := r.collection.UpdateOne(ctx, filter, update)
+	return err
+}
+
+func (r *mongoProducts) MarkSoldOut(ctx context.Context, code string) error {
+	filter := bson.M{
+		"code":  code,
+		"stock": bson.M{"$lte": 0},
+	}
+	update := bson.M{"$set": bson.M{
+		"soldOut":  true,
+		"canOrder": false,
+	}}
+
+	_, err := r.collection.UpdateOne(ctx, filter, update)
+	return err
+}
+
+func (r *mongoProducts) Reopen(ctx context.Context, code string) error {
+	filter := bson.M{
+		"code":    code,
+		"soldOut": true,
+		"stock":   bson.M{"$gt": 0},
+	}
+	update := bson.M{"$set": bson.M{
+		"soldOut":  false,
+		"canOrder": true,
+	}}
+
+	_, err := r.collection.UpdateOne(ctx, filter, update)
+	return err
+}
+
+func (r *mongoProducts) SetStock(ctx context.Context, code string, stock int, soldOut *bool, updatedAt int64) (*mongo.UpdateResult, error) {
+	set := bson.M{
+		"stock":     stock,
+		"updatedAt": updatedAt,
+	}
+	if soldOut != nil {
+		set["soldOut"] = *soldOut
+		set["canOrder"] = !*soldOut
+	}
+
+	filter := bson.M{"code": code}
+	update := bson.M{"$set": set}
+
+	return r.updateOne(ctx, filter, update)
+}
+
+func (r *mongoProducts) ResetStock(ctx context.Context, resetAt int64) (*mongo.UpdateResult, error) {
+	filter := bson.M{"stockResetAt": bson.M{"$not": bson.M{"$gte": resetAt}}}
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"stock":        "$limit",
+		"stockResetAt": resetAt,
+		"canOrder": bson.M{"$cond": bson.A{
+			bson.M{"$eq": bson.A{"$soldOut", true}},
+			true,
+			"$canOrder",
+		}},
+		"soldOut": false,
+	}}}}
+
+	return r.collection.UpdateMany(ctx, filter, update)
+}
+
+func (r *mongoProducts) CountReview(ctx context.Context, code string, count ReviewCount) error {
+	like := 0
+	if count.Liked {
+		like = 1
+	}
+	filter := bson.M{"code": code}
+	update := bson.M{"$inc": bson.M{
+		"userOrders." + count.Username:  count.Sign,
+		"reviewCount":                   count.Sign,
+		"ratingSum":                     float64(count.Sign) * count.Rating,
+		"likeCount":                     count.Sign * like,
+		"ratingHistogram." + count.Star: count.Sign,
+	}}
+
+	_, err := r.updateOne(ctx, filter, update)
+	return err
+}
+
+func (r *mongoProducts) updateOne(ctx context.Context, filter interface{}, update interface{}) (*mongo.UpdateResult, error) {
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount != 1 {
+		return nil, errors.New("no match to update")
+	}
+
+	return result, nil
+}
+
+// References
+// https://www.mongodb.com/docs/manual/tutorial/update-documents-with-aggregation-pipeline/
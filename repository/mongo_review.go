@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"oos/dto"
+	"oos/model"
+)
+
+type mongoReviews struct {
+	collection *mongo.Collection
+}
+
+// Insert relies on the unique index on orderID to reject a second review.
+func (r *mongoReviews) Insert(ctx context.Context, review model.ReviewOrder) (*mongo.InsertOneResult, error) {
+	result, err := r.collection.InsertOne(ctx, review)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrDuplicate
+	}
+
+	return result, err
+}
+
+func (r *mongoReviews) Get(ctx context.Context, orderID string) (*model.ReviewOrder, error) {
+	filter := bson.M{"orderID": orderID}
+
+	var review model.ReviewOrder
+	if err := r.collection.FindOne(ctx, filter).Decode(&review); err != nil {
+		return nil, err
+	}
+
+	return &review, nil
+}
+
+func (r *mongoReviews) Replace(ctx context.Context, review model.ReviewOrder) (*mongo.UpdateResult, error) {
+	filter := bson.M{"orderID": review.OrderID}
+
+	result, err := r.collection.ReplaceOne(ctx, filter, review)
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount != 1 {
+		return nil, errors.New("no match to update")
+	}
+
+	return result, nil
+}
+
+func (r *mongoReviews) Delete(ctx context.Context, orderID string) (*mongo.DeleteResult, error) {
+	filter := bson.M{"orderID": orderID}
+
+	result, err := r.collection.DeleteOne(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	if result.DeletedCount != 1 {
+		return nil, errors.New("no match to delete")
+	}
+
+	return result, nil
+}
+
+func (r *mongoReviews) SetHidden(ctx context.Context, orderID string, hidden bool) (*mongo.UpdateResult, error) {
+	// Reviews written before moderation existed have no hidden field.
+	filter := bson.M{"orderID": orderID, "hidden": bson.M{"$ne": hidden}}
+	update := bson.M{"$set": bson.M{"hidden": hidden}}
+
+	return r.collection.UpdateOne(ctx, filter, update)
+}
+
+func (r *mongoReviews) List(ctx context.Context, query dto.PageQuery) (*dto.Page, error) {
+	sort := bson.D{{Key: "orderID", Value: 1}}
+
+	page, err := paginate(ctx, r.collection, mongo.Pipeline{}, sort, query)
+	if err != nil {
+		return nil, err
+	}
+
+	reviews := []model.ReviewOrder{}
+	for _, doc := range page.docs {
+		var review model.ReviewOrder
+		if err := bson.Unmarshal(doc, &review); err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, review)
+	}
+
+	return &dto.Page{Items: reviews, NextCursor: page.nextCursor, Total: page.total}, nil
+}
+
+func (r *mongoReviews) ListByProduct(ctx context.Context, code string, query dto.ReviewQuery) (*dto.Page, error) {
+	// The first match uses the index on reviewProducts.productCode; the
+	// second keeps only the unwound line of this product.
+	productFilter := bson.M{"reviewProducts.productCode": code}
+	lineFilter := bson.M{"reviewProducts.productCode": code}
+	if query.WithComment {
+		lineFilter["reviewProducts.comment"] = bson.M{"$nin": bson.A{"", nil}}
+	}
+
+	sort := bson.D{{Key: "createdAt", Value: -1}}
+	switch query.Sort {
+	case "highest":
+		sort = bson.D{{Key: "rating", Value: -1}, {Key: "createdAt", Value: -1}}
+	case "lowest":
+		sort = bson.D{{Key: "rating", Value: 1}, {Key: "createdAt", Value: -1}}
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: productFilter}},
+		{{Key: "$match", Value: bson.M{"hidden": bson.M{"$ne": true}}}},
+		{{Key: "$unwind", Value: "$reviewProducts"}},
+		{{Key: "$match", Value: lineFilter}},
+		{{Key: "$project", Value: bson.M{
+			// Keep every sort key present, as paginate needs, should a
+			// review without createdAt remain.
+			"createdAt":     bson.M{"$ifNull": bson.A{"$createdAt", 0}},
+			"username":      1,
+			"reviewProduct": "$reviewProducts",
+			// A product rating overrides the rating of the whole order.
+			"rating": bson.M{"$cond": bson.A{
+				bson.M{"$gt": bson.A{"$reviewProducts.rating", 0}},
+				"$reviewProducts.rating",
+				"$rating",
+			}},
+		}}},
+	}
+
+	page, err := paginate(ctx, r.collection, pipeline, sort, query.PageQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	reviews := []model.ReviewView{}
+	for _, doc := range page.docs {
+		var review model.ReviewView
+		if err := bson.Unmarshal(doc, &review); err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, review)
+	}
+
+	return &dto.Page{Items: reviews, NextCursor: page.nextCursor, Total: page.total}, nil
+}
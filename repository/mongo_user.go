@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"oos/model"
+)
+
+type mongoUsers struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoUsers) Insert(ctx context.Context, user model.User) (*mongo.InsertOneResult, error) {
+	result, err := r.collection.InsertOne(ctx, user)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrDuplicate
+	}
+
+	return result, err
+}
+
+func (r *mongoUsers) Get(ctx context.Context, username string) (*model.User, error) {
+	filter := bson.M{"username": username}
+
+	var user model.User
+	if err := r.collection.FindOne(ctx, filter).Decode(&user); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (r *mongoUsers) AddRole(ctx context.Context, username string, role string) (*mongo.UpdateResult, error) {
+	filter := bson.M{"username": username}
+	update := bson.M{
+		"$addToSet": bson.M{"roles": role},
+		"$set":      bson.M{"updatedAt": time.Now().UnixMicro()},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount != 1 {
+		return nil, mongo.ErrNoDocuments
+	}
+
+	return result, nil
+}
+
+type mongoTokens struct {
+	collection *mongo.Collection
+}
+
+// Revoke records a token once; the TTL index on expiresAt removes it when it
+// could no longer be used anyway.
+func (r *mongoTokens) Revoke(ctx context.Context, tokenID string, username string, expiresAt time.Time) error {
+	filter := bson.M{"_id": tokenID}
+	update := bson.M{"$setOnInsert": bson.M{
+		"username":  username,
+		"expiresAt": expiresAt,
+	}}
+	opts := options.Update().SetUpsert(true)
+
+	_, err := r.collection.UpdateOne(ctx, filter, update, opts)
+	return err
+}
+
+func (r *mongoTokens) IsRevoked(ctx context.Context, tokenID string) (bool, error) {
+	filter := bson.M{"_id": tokenID}
+
+	err := r.collection.FindOne(ctx, filter).Err()
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
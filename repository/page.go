@@ -0,0 +1,177 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"oos/dto"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// pageCursor holds the sort keys and their values in the last document of a
+// page. It is sent to clients as opaque base64 encoded BSON.
+type pageCursor struct {
+	Keys   []string `bson:"k"`
+	Values bson.A   `bson:"v"`
+}
+
+// rawPage is one page of documents before they are decoded.
+type rawPage struct {
+	docs       []bson.Raw
+	nextCursor string
+	total      *int64
+}
+
+// paginate runs pipeline on collection, sorts the result by sort with _id as
+// the tie-breaker and returns the page after query.Cursor. Every sort key must
+// be present in the documents that leave the pipeline.
+func paginate(ctx context.Context, collection *mongo.Collection, pipeline mongo.Pipeline, sort bson.D, query dto.PageQuery) (*rawPage, error) {
+	limit := query.Limit
+	if limit <= 0 {
+		limit = defaultPageLimit
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+
+	sort = append(append(bson.D{}, sort...), bson.E{Key: "_id", Value: 1})
+
+	page := &rawPage{}
+	if query.Total {
+		total, err := countPipeline(ctx, collection, pipeline)
+		if err != nil {
+			return nil, err
+		}
+		page.total = &total
+	}
+
+	stages := append(mongo.Pipeline{}, pipeline...)
+	if query.Cursor != "" {
+		after, err := afterCursor(query.Cursor, sort)
+		if err != nil {
+			return nil, err
+		}
+		stages = append(stages, bson.D{{Key: "$match", Value: after}})
+	}
+	// One extra document tells whether there is a next page.
+	stages = append(stages,
+		bson.D{{Key: "$sort", Value: sort}},
+		bson.D{{Key: "$limit", Value: int64(limit + 1)}},
+	)
+
+	cursor, err := collection.Aggregate(ctx, stages)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		page.docs = append(page.docs, append(bson.Raw{}, cursor.Current...))
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(page.docs) > limit {
+		page.docs = page.docs[:limit]
+		nextCursor, err := encodeCursor(page.docs[limit-1], sort)
+		if err != nil {
+			return nil, err
+		}
+		page.nextCursor = nextCursor
+	}
+
+	return page, nil
+}
+
+func countPipeline(ctx context.Context, collection *mongo.Collection, pipeline mongo.Pipeline) (int64, error) {
+	stages := append(append(mongo.Pipeline{}, pipeline...), bson.D{{Key: "$count", Value: "total"}})
+
+	cursor, err := collection.Aggregate(ctx, stages)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var result struct {
+		Total int64 `bson:"total"`
+	}
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&result); err != nil {
+			return 0, err
+		}
+	}
+
+	return result.Total, cursor.Err()
+}
+
+func encodeCursor(doc bson.Raw, sort bson.D) (string, error) {
+	var c pageCursor
+	for _, key := range sort {
+		value, err := doc.LookupErr(strings.Split(key.Key, ".")...)
+		if err != nil {
+			return "", err
+		}
+		c.Keys = append(c.Keys, key.Key)
+		c.Values = append(c.Values, value)
+	}
+
+	b, err := bson.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// afterCursor builds the filter that matches every document sorted after the
+// cursor: the first key is past its value, or it is equal and the next key is
+// past its value, and so on.
+func afterCursor(cursor string, sort bson.D) (bson.M, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c pageCursor
+	if err := bson.Unmarshal(b, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	// A cursor only resumes the sort it was issued for.
+	if len(c.Keys) != len(sort) || len(c.Values) != len(sort) {
+		return nil, ErrInvalidCursor
+	}
+	for i, key := range sort {
+		if c.Keys[i] != key.Key {
+			return nil, ErrInvalidCursor
+		}
+	}
+
+	or := bson.A{}
+	for i, key := range sort {
+		op := "$gt"
+		if direction, ok := key.Value.(int); ok && direction < 0 {
+			op = "$lt"
+		}
+
+		branch := bson.M{}
+		for j := 0; j < i; j++ {
+			branch[sort[j].Key] = c.Values[j]
+		}
+		branch[key.Key] = bson.M{op: c.Values[i]}
+		or = append(or, branch)
+	}
+
+	return bson.M{"$or": or}, nil
+}
+
+// References
+// https://www.mongodb.com/docs/manual/reference/method/cursor.skip/#using-range-queries
@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"oos/dto"
+	"oos/model"
+)
+
+// listFixtures are products whose computed sort fields all differ, so that
+// every sort has a single right order.
+var listFixtures = []model.ProductDocument{
+	// Never reviewed, so its average rating divides by zero.
+	{Code: "none", CreatedAt: 1, CanView: true, CanOrder: true},
+	{Code: "high", CreatedAt: 2, CanView: true, CanOrder: true, RatingSum: 10, ReviewCount: 2, LikeCount: 1, UserOrders: map[string]int{"a": 2}},
+	{Code: "mid", CreatedAt: 3, CanView: true, CanOrder: true, RatingSum: 12, ReviewCount: 4, LikeCount: 5, UserOrders: map[string]int{"a": 3, "b": 3}},
+	{Code: "low", CreatedAt: 4, CanView: true, CanOrder: true, RatingSum: 1, ReviewCount: 1, LikeCount: 2, UserOrders: map[string]int{"a": 3}},
+	{Code: "closed", CreatedAt: 5, CanView: true, CanOrder: false, RatingSum: 4, ReviewCount: 2, LikeCount: 3, UserOrders: map[string]int{"a": 4}},
+	{Code: "soldout", CreatedAt: 6, CanView: true, CanOrder: true, SoldOut: true, RatingSum: 4, ReviewCount: 1, LikeCount: 4, UserOrders: map[string]int{"a": 6}},
+	// Would lead every sort if customers could see it.
+	{Code: "hidden", CreatedAt: 9, CanView: false, CanOrder: true, RatingSum: 50, ReviewCount: 10, LikeCount: 9, UserOrders: map[string]int{"a": 10}},
+}
+
+func productCodes(page *dto.Page) []string {
+	codes := []string{}
+	for _, product := range page.Items.([]model.ProductView) {
+		codes = append(codes, product.Code)
+	}
+	return codes
+}
+
+func TestProductList(t *testing.T) {
+	tests := []struct {
+		name  string
+		query dto.ProductQuery
+		codes []string
+	}{
+		{
+			name:  "ratings",
+			query: dto.ProductQuery{Sort: "ratings"},
+			codes: []string{"high", "soldout", "mid", "closed", "low", "none"},
+		},
+		{
+			name:  "ratings ascending",
+			query: dto.ProductQuery{Sort: "ratings", Order: "asc"},
+			codes: []string{"none", "low", "closed", "mid", "soldout", "high"},
+		},
+		{
+			name:  "reorders",
+			query: dto.ProductQuery{Sort: "reorders"},
+			codes: []string{"soldout", "mid", "closed", "low", "high", "none"},
+		},
+		{
+			name:  "likes",
+			query: dto.ProductQuery{Sort: "likes"},
+			codes: []string{"mid", "soldout", "closed", "low", "high", "none"},
+		},
+		{
+			name:  "time",
+			query: dto.ProductQuery{Sort: "time"},
+			codes: []string{"soldout", "closed", "low", "mid", "high", "none"},
+		},
+		{
+			name:  "orderable",
+			query: dto.ProductQuery{Sort: "ratings", Orderable: true},
+			codes: []string{"high", "mid", "low", "none"},
+		},
+	}
+
+	eachRepositories(t, func(t *testing.T, repos Repositories) {
+		ctx := context.Background()
+		for _, product := range listFixtures {
+			if _, err := repos.Products.Insert(ctx, product); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				page, err := repos.Products.List(ctx, tt.query)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if codes := productCodes(page); !reflect.DeepEqual(codes, tt.codes) {
+					t.Errorf("codes = %v, want %v", codes, tt.codes)
+				}
+			})
+		}
+
+		// A cursor on a computed field picks up where the last page ended.
+		t.Run("pages", func(t *testing.T) {
+			query := dto.ProductQuery{Sort: "ratings", PageQuery: dto.PageQuery{Limit: 4, Total: true}}
+			first, err := repos.Products.List(ctx, query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if first.Total == nil || *first.Total != 6 {
+				t.Errorf("total = %v, want 6", first.Total)
+			}
+
+			query.Cursor = first.NextCursor
+			second, err := repos.Products.List(ctx, query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if second.NextCursor != "" {
+				t.Errorf("next cursor after the last page = %q", second.NextCursor)
+			}
+
+			codes := append(productCodes(first), productCodes(second)...)
+			if want := tests[0].codes; !reflect.DeepEqual(codes, want) {
+				t.Errorf("codes = %v, want %v", codes, want)
+			}
+		})
+	})
+}
@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"oos/dto"
+	"oos/model"
+)
+
+// A missing document is reported as mongo.ErrNoDocuments by every
+// implementation, so that callers need not know which one they use.
+var (
+	ErrDuplicate     = errors.New("duplicate key")
+	ErrInvalidCursor = errors.New("invalid page cursor")
+)
+
+// Repositories are the stores the service package works with.
+type Repositories struct {
+	Products     ProductRepository
+	Orders       OrderRepository
+	Reviews      ReviewRepository
+	Users        UserRepository
+	Tokens       TokenRepository
+	Transactions Transactor
+}
+
+// Transactor runs fn so that the writes it makes through the repositories are
+// applied together or not at all. fn may run more than once and must use the
+// context it is given.
+type Transactor interface {
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) (interface{}, error)) (interface{}, error)
+}
+
+type ProductRepository interface {
+	Insert(ctx context.Context, product model.ProductDocument) (*mongo.InsertOneResult, error)
+	Get(ctx context.Context, code string) (*model.ProductDocument, error)
+	FindByCodes(ctx context.Context, codes []string) ([]model.ProductDocument, error)
+	// List pages through the products customers can see.
+	List(ctx context.Context, query dto.ProductQuery) (*dto.Page, error)
+	Update(ctx context.Context, code string, params dto.ProductUpdate, updatedAt int64) (*mongo.UpdateResult, error)
+	Hide(ctx context.Context, code string, updatedAt int64) (*mongo.UpdateResult, error)
+
+	// Reserve takes quantity out of stock if the product can be ordered and
+	// has enough left, and reports whether it did.
+	Reserve(ctx context.Context, code string, quantity int) (bool, error)
+	// Release puts quantity back into stock, but not past the limit, which
+	// a reset since the quantity was reserved may already have restored.
+	Release(ctx context.Context, code string, quantity int) error
+	// MarkSoldOut closes the product if it has no stock left.
+	MarkSoldOut(ctx context.Context, code string) error
+	// Reopen opens the product if it was closed for selling out and has stock again.
+	Reopen(ctx context.Context, code string) error
+	// SetStock sets the stock, and the sold out state unless it is nil.
+	SetStock(ctx context.Context, code string, stock int, soldOut *bool, updatedAt int64) (*mongo.UpdateResult, error)
+	// ResetStock refills every product not reset since resetAt to its limit.
+	ResetStock(ctx context.Context, resetAt int64) (*mongo.UpdateResult, error)
+
+	// CountReview adds a review to the aggregates of a product.
+	CountReview(ctx context.Context, code string, count ReviewCount) error
+}
+
+// ReviewCount is what one review adds to the aggregates of a product, or
+// takes out of them when Sign is -1.
+type ReviewCount struct {
+	Username string
+	Sign     int
+	Rating   float64
+	Star     string
+	Liked    bool
+}
+
+type OrderRepository interface {
+	Insert(ctx context.Context, order model.Order) (*mongo.InsertOneResult, error)
+	Get(ctx context.Context, id string) (*model.Order, error)
+	// List pages through the orders matching filter, oldest first.
+	List(ctx context.Context, filter OrderFilter, page dto.PageQuery) (*dto.Page, error)
+	UpdateStatus(ctx context.Context, id string, change model.OrderStatusChange) (*mongo.UpdateResult, error)
+	// UpdateCart saves the cart, items and totals of order.
+	UpdateCart(ctx context.Context, order model.Order, updatedAt int64) (*mongo.UpdateResult, error)
+}
+
+// OrderFilter narrows a list of orders. Empty fields match every order.
+type OrderFilter struct {
+	Username        string
+	Statuses        []string
+	ExcludeStatuses []string
+	// CreatedFrom and CreatedTo bound the creation time in microseconds,
+	// inclusive and exclusive.
+	CreatedFrom int64
+	CreatedTo   int64
+}
+
+type ReviewRepository interface {
+	// Insert fails with ErrDuplicate if the order already has a review.
+	Insert(ctx context.Context, review model.ReviewOrder) (*mongo.InsertOneResult, error)
+	Get(ctx context.Context, orderID string) (*model.ReviewOrder, error)
+	Replace(ctx context.Context, review model.ReviewOrder) (*mongo.UpdateResult, error)
+	Delete(ctx context.Context, orderID string) (*mongo.DeleteResult, error)
+	SetHidden(ctx context.Context, orderID string, hidden bool) (*mongo.UpdateResult, error)
+	// List pages through every review by order ID.
+	List(ctx context.Context, page dto.PageQuery) (*dto.Page, error)
+	// ListByProduct pages through the visible reviews of a product.
+	ListByProduct(ctx context.Context, code string, query dto.ReviewQuery) (*dto.Page, error)
+}
+
+type UserRepository interface {
+	// Insert fails with ErrDuplicate if the username is taken.
+	Insert(ctx context.Context, user model.User) (*mongo.InsertOneResult, error)
+	Get(ctx context.Context, username string) (*model.User, error)
+	// AddRole fails with mongo.ErrNoDocuments if there is no such user.
+	AddRole(ctx context.Context, username string, role string) (*mongo.UpdateResult, error)
+}
+
+// TokenRepository keeps the IDs of revoked tokens until they expire.
+type TokenRepository interface {
+	Revoke(ctx context.Context, tokenID string, username string, expiresAt time.Time) error
+	IsRevoked(ctx context.Context, tokenID string) (bool, error)
+}
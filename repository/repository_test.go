@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"oos/config"
+	"oos/db"
+	"oos/migrations"
+)
+
+// mongoRepositories returns repositories on a new database of the replica set
+// at OOS_TEST_MONGO_URI, which is dropped after the test. The test is skipped
+// if the variable is not set.
+func mongoRepositories(t *testing.T) Repositories {
+	t.Helper()
+
+	uri := os.Getenv("OOS_TEST_MONGO_URI")
+	if uri == "" {
+		t.Skip("OOS_TEST_MONGO_URI is not set")
+	}
+
+	cfg := config.Default()
+	cfg.DB.Host = uri
+	cfg.DB.Name = fmt.Sprintf("oos_test_%d", time.Now().UnixNano())
+	database, err := db.Connect(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ctx := context.Background()
+		database.Drop(ctx)
+		database.Client().Disconnect(ctx)
+	})
+
+	if _, err := migrations.Up(context.Background(), database); err != nil {
+		t.Fatal(err)
+	}
+
+	return NewMongo(database)
+}
+
+// eachRepositories runs test on the in-memory repositories and, if
+// OOS_TEST_MONGO_URI is set, on MongoDB, which must agree.
+func eachRepositories(t *testing.T, test func(t *testing.T, repos Repositories)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, NewMemory())
+	})
+	t.Run("mongo", func(t *testing.T) {
+		test(t, mongoRepositories(t))
+	})
+}
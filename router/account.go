@@ -3,10 +3,14 @@ package router
 import (
 	"github.com/gin-gonic/gin"
 
-	"oos/controller"
+	"oos/middleware"
 )
 
-func addAccountRoutes(rg *gin.RouterGroup) {
+func addAccountRoutes(rg *gin.RouterGroup, auth *middleware.Auth, h handlers) {
 	account := rg.Group("/account")
-	account.POST("/login/:role", controller.Login)
+	account.POST("/register", h.accounts.Register)
+	account.POST("/login/:role", h.accounts.Login)
+	account.POST("/refresh", h.accounts.Refresh)
+	account.POST("/logout", auth.ValidateToken(), h.accounts.Logout)
+	account.GET("/jwks.json", h.accounts.JWKS)
 }
\ No newline at end of file
@@ -3,27 +3,30 @@ package router
 import (
 	"github.com/gin-gonic/gin"
 
-	"oos/controller"
 	"oos/middleware"
 )
 
-func addCustomerRoutes(rg *gin.RouterGroup) {
+func addCustomerRoutes(rg *gin.RouterGroup, auth *middleware.Auth, h handlers) {
 	customer := rg.Group("/customer")
-	customer.Use(middleware.ValidateToken())
-	customer.Use(middleware.ValidateScope("customer"))
+	customer.Use(auth.ValidateToken())
+	customer.Use(auth.ValidateScope("customer"))
 
-	customer.GET("/products", controller.ListProducts)
-	customer.GET("/products/:code", controller.GetProduct)
+	customer.GET("/products", h.products.ListProducts)
+	customer.GET("/products/:code", h.products.GetProduct)
 
-	customer.GET(":username/orders/active", controller.ListOrdersActive)
-	customer.GET(":username/orders/history", controller.ListOrdersHistory)
+	customer.GET("/orders", h.orders.ListCustomerOrders)
+	customer.GET("/me/orders", h.orders.ListCustomerOrders)
+	customer.GET("/me/orders/active", h.orders.ListCustomerOrdersState("active"))
+	customer.GET("/me/orders/history", h.orders.ListCustomerOrdersState("history"))
+	customer.GET("/orders/:id", h.orders.GetOrder)
+	customer.POST("/orders", h.orders.CreateOrder)
+	customer.PUT("/orders/:id/cart", h.orders.UpdateOrderItems)
+	customer.DELETE("/orders/:id/cart", h.orders.DeleteOrderItems)
+	customer.GET("/orders/:id/status", h.orders.GetOrderStatus)
+	customer.PUT("/orders/:id/status", h.orders.UpdateOrderStatus)
 
-	customer.GET("/orders/:id", controller.GetOrder)
-	customer.POST("/orders", controller.CreateOrder)
-	customer.PUT("/orders/:id/cart", controller.UpdateOrderItems)
-	customer.DELETE("/orders/:id/cart", controller.DeleteOrderItems)
-	customer.GET("/orders/:id/status", controller.GetOrderStatus)
-
-	customer.POST("/reviews/orders/:id", controller.CreateReview)
-	customer.GET("/reviews/products/:code", controller.ListReviewsProduct)
+	customer.POST("/reviews/orders/:id", h.reviews.CreateReview)
+	customer.PUT("/reviews/orders/:id", h.reviews.UpdateReview)
+	customer.DELETE("/reviews/orders/:id", h.reviews.DeleteReview)
+	customer.GET("/reviews/products/:code", h.reviews.ListReviewsProduct)
 }
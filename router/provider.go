@@ -3,21 +3,25 @@ package router
 import (
 	"github.com/gin-gonic/gin"
 
-	"oos/controller"
 	"oos/middleware"
 )
 
-func addProviderRoutes(rg *gin.RouterGroup) {
+func addProviderRoutes(rg *gin.RouterGroup, auth *middleware.Auth, h handlers) {
 	provider := rg.Group("/provider")
-	provider.Use(middleware.ValidateToken())
-	provider.Use(middleware.ValidateScope("provider"))
+	provider.Use(auth.ValidateToken())
+	provider.Use(auth.ValidateScope("provider"))
 
-	provider.POST("/products", controller.CreateProduct)
-	provider.PUT("/products/:code", controller.UpdateProduct)
-	provider.DELETE("/products/:code", controller.DeleteProduct)
+	provider.PUT("/accounts/:username/roles", h.accounts.GrantRole)
 
-	provider.GET("/orders", controller.ListOrders)
-	provider.PUT("/orders/:id/status", controller.UpdateOrderStatus)
+	provider.POST("/products", h.products.CreateProduct)
+	provider.PUT("/products/:code", h.products.UpdateProduct)
+	provider.DELETE("/products/:code", h.products.DeleteProduct)
+	provider.GET("/products/:code/stock", h.products.GetStock)
+	provider.PUT("/products/:code/stock", h.products.UpdateStock)
 
-	provider.GET("/reviews/orders", controller.ListReviews)
+	provider.GET("/orders", h.orders.ListOrders)
+	provider.PUT("/orders/:id/status", h.orders.UpdateOrderStatus)
+
+	provider.GET("/reviews/orders", h.reviews.ListReviews)
+	provider.PUT("/reviews/orders/:id/hidden", h.reviews.HideReview)
 }
@@ -5,15 +5,23 @@ import (
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 
+	"oos/app"
+	"oos/controller"
 	_ "oos/docs"
 	"oos/logger"
-	"oos/middleware"
 )
 
-func Engine() *gin.Engine {
-	gin.SetMode(gin.DebugMode)
-	// gin.SetMode(gin.ReleaseMode)
+// handlers are the request handlers of one application.
+type handlers struct {
+	accounts *controller.AccountHandler
+	products *controller.ProductHandler
+	orders   *controller.OrderHandler
+	reviews  *controller.ReviewHandler
+}
 
+// Engine builds the HTTP handler of a. It runs in the Gin mode of the
+// process, which main sets once from server.mode.
+func Engine(a *app.App) *gin.Engine {
 	e := gin.Default()
 
 	// Default middleware
@@ -21,20 +29,26 @@ func Engine() *gin.Engine {
 	// e.Use(gin.Recovery())
 
 	// Custom middleware
-	e.Use(logger.GinLogger())
-	e.Use(logger.GinRecovery(true))
-	e.Use(middleware.CORS())
+	e.Use(logger.GinLogger(a.Logger))
+	e.Use(logger.GinRecovery(a.Logger, true))
+	e.Use(a.CORS.Handler())
 
 	// Route groups
+	h := handlers{
+		accounts: &controller.AccountHandler{Service: a.Service, Auth: a.Auth},
+		products: &controller.ProductHandler{Service: a.Service},
+		orders:   &controller.OrderHandler{Service: a.Service},
+		reviews:  &controller.ReviewHandler{Service: a.Service},
+	}
 	v1 := e.Group("/v1")
-	addAccountRoutes(v1)
-	addCustomerRoutes(v1)
-	addProviderRoutes(v1)
+	addAccountRoutes(v1, a.Auth, h)
+	addCustomerRoutes(v1, a.Auth, h)
+	addProviderRoutes(v1, a.Auth, h)
 
 	// Swagger documentation
 	e.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
-	logger.Info("Start server")
+	a.Logger.Info("Start server")
 
 	return e
 }
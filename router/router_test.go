@@ -0,0 +1,646 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"oos/app"
+	"oos/config"
+	"oos/dto"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// envelope is a dto.HTTPResponse whose data is left to the test to decode.
+type envelope struct {
+	Code  int             `json:"code"`
+	Text  string          `json:"text"`
+	Error string          `json:"error"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// testServer is the engine of an in-memory application.
+type testServer struct {
+	app    *app.App
+	engine *gin.Engine
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	cfg := config.Default()
+	cfg.Auth.Secret = "test secret"
+
+	a, err := app.NewMemory(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testServer{app: a, engine: Engine(a)}
+}
+
+// serve sends body as JSON with token as the Authorization header.
+func (s *testServer) serve(t *testing.T, method, path, token string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var b []byte
+	if body != nil {
+		var err error
+		if b, err = json.Marshal(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req := httptest.NewRequest(method, path, bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	w := httptest.NewRecorder()
+	s.engine.ServeHTTP(w, req)
+	return w
+}
+
+// do is serve for a response that must have status, and returns its envelope.
+func (s *testServer) do(t *testing.T, method, path, token string, body interface{}, status int) envelope {
+	t.Helper()
+
+	w := s.serve(t, method, path, token, body)
+	if w.Code != status {
+		t.Fatalf("%s %s: status = %d, want %d: %s", method, path, w.Code, status, w.Body)
+	}
+	var response envelope
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("%s %s: %v: %s", method, path, err, w.Body)
+	}
+	if response.Code != status {
+		t.Errorf("%s %s: envelope code = %d, want %d", method, path, response.Code, status)
+	}
+	return response
+}
+
+// expectError is do for a response that must carry errorCode.
+func (s *testServer) expectError(t *testing.T, method, path, token string, body interface{}, status int, errorCode string) {
+	t.Helper()
+
+	response := s.do(t, method, path, token, body, status)
+	if response.Error != errorCode {
+		t.Errorf("%s %s: error = %q, want %q", method, path, response.Error, errorCode)
+	}
+}
+
+func decode(t *testing.T, response envelope, v interface{}) {
+	t.Helper()
+
+	if err := json.Unmarshal(response.Data, v); err != nil {
+		t.Fatalf("%v: %s", err, response.Data)
+	}
+}
+
+func user(username string) dto.UserCreate {
+	return dto.UserCreate{
+		Username: username,
+		Email:    username + "@gmail.com",
+		Phone:    "+821011112222",
+		Address: dto.AddressCreate{
+			CountryCode:        "KOR",
+			AdministrativeArea: "Seoul",
+			Locality:           "Jongno-gu",
+			StreetAddress:      "Jong-ro 1",
+			PostalCode:         "03154",
+		},
+	}
+}
+
+func (s *testServer) register(t *testing.T, username string) {
+	t.Helper()
+
+	s.do(t, http.MethodPost, "/v1/account/register", "", dto.AccountCreate{
+		Password:   "password1234",
+		UserCreate: user(username),
+	}, http.StatusCreated)
+}
+
+func (s *testServer) login(t *testing.T, username, role string) (access, refresh string) {
+	t.Helper()
+
+	response := s.do(t, http.MethodPost, "/v1/account/login/"+role, "", dto.AccountLogin{
+		Username: username,
+		Password: "password1234",
+	}, http.StatusOK)
+
+	var token struct {
+		JwtToken     string `json:"jwtToken"`
+		RefreshToken string `json:"refreshToken"`
+	}
+	decode(t, response, &token)
+	return token.JwtToken, token.RefreshToken
+}
+
+// session registers a customer, cust1, and a provider, prov1, and logs them in.
+func session(t *testing.T) (s *testServer, customer, provider string) {
+	t.Helper()
+
+	s = newTestServer(t)
+	s.register(t, "cust1")
+	s.register(t, "prov1")
+	if _, err := s.app.Service.GrantRole(context.Background(), "prov1", "provider"); err != nil {
+		t.Fatal(err)
+	}
+
+	customer, _ = s.login(t, "cust1", "customer")
+	provider, _ = s.login(t, "prov1", "provider")
+	return s, customer, provider
+}
+
+func product(code string, limit int) dto.ProductCreate {
+	return dto.ProductCreate{
+		Code: code,
+		ProductUpdate: dto.ProductUpdate{
+			Name:     "Chicken burrito",
+			Origin:   "Mexico",
+			Price:    10,
+			Limit:    limit,
+			CanOrder: true,
+			CanView:  true,
+		},
+	}
+}
+
+// createOrder places an order for cust1 and returns its ID.
+func (s *testServer) createOrder(t *testing.T, customer string, cart map[string]int) string {
+	t.Helper()
+
+	response := s.do(t, http.MethodPost, "/v1/customer/orders", customer, dto.OrderCreate{
+		User:            user("cust1"),
+		OrderUpdateCart: dto.OrderUpdateCart{Cart: cart},
+	}, http.StatusCreated)
+
+	var result struct {
+		InsertedID string
+	}
+	decode(t, response, &result)
+	return result.InsertedID
+}
+
+func (s *testServer) setStatus(t *testing.T, group, token, orderID, status string, code int) envelope {
+	t.Helper()
+
+	return s.do(t, http.MethodPut, "/v1/"+group+"/orders/"+orderID+"/status", token, dto.OrderUpdateStatus{Status: status}, code)
+}
+
+func TestAccountRoutes(t *testing.T) {
+	s := newTestServer(t)
+	s.register(t, "cust1")
+
+	s.expectError(t, http.MethodPost, "/v1/account/login/customer", "", dto.AccountLogin{
+		Username: "cust1",
+		Password: "wrong password",
+	}, http.StatusUnauthorized, dto.ErrCodeInvalidCredentials)
+	s.expectError(t, http.MethodPost, "/v1/account/login/provider", "", dto.AccountLogin{
+		Username: "cust1",
+		Password: "password1234",
+	}, http.StatusForbidden, dto.ErrCodeInsufficientScope)
+
+	access, refresh := s.login(t, "cust1", "customer")
+
+	response := s.do(t, http.MethodPost, "/v1/account/refresh", "", dto.TokenRefresh{RefreshToken: refresh}, http.StatusOK)
+	var token struct {
+		JwtToken string `json:"jwtToken"`
+	}
+	decode(t, response, &token)
+	if token.JwtToken == "" {
+		t.Error("refresh returned no access token")
+	}
+
+	w := s.serve(t, http.MethodGet, "/v1/account/jwks.json", "", nil)
+	var jwks struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	if w.Code != http.StatusOK {
+		t.Fatalf("jwks status = %d, want 200: %s", w.Code, w.Body)
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &jwks); err != nil || jwks.Keys == nil {
+		t.Errorf("jwks = %s, want a key set", w.Body)
+	}
+
+	s.expectError(t, http.MethodPost, "/v1/account/logout", "", nil, http.StatusUnauthorized, dto.ErrCodeTokenMissing)
+	s.do(t, http.MethodPost, "/v1/account/logout", access, dto.TokenRefresh{RefreshToken: refresh}, http.StatusOK)
+	s.expectError(t, http.MethodGet, "/v1/customer/products", access, nil, http.StatusUnauthorized, dto.ErrCodeTokenRevoked)
+	s.expectError(t, http.MethodPost, "/v1/account/refresh", "", dto.TokenRefresh{RefreshToken: refresh}, http.StatusUnauthorized, dto.ErrCodeTokenRevoked)
+}
+
+func TestRegisterGrantsCustomerOnly(t *testing.T) {
+	s, _, provider := session(t)
+
+	s.register(t, "cust2")
+	s.expectError(t, http.MethodPost, "/v1/account/register", "", dto.AccountCreate{
+		Password:   "password1234",
+		UserCreate: user("cust2"),
+	}, http.StatusConflict, "")
+	s.expectError(t, http.MethodPost, "/v1/account/login/provider", "", dto.AccountLogin{
+		Username: "cust2",
+		Password: "password1234",
+	}, http.StatusForbidden, dto.ErrCodeInsufficientScope)
+
+	s.do(t, http.MethodPut, "/v1/provider/accounts/cust2/roles", provider, dto.RoleGrant{Role: "provider"}, http.StatusOK)
+	s.login(t, "cust2", "provider")
+	s.login(t, "cust2", "customer")
+
+	s.do(t, http.MethodPut, "/v1/provider/accounts/nobody/roles", provider, dto.RoleGrant{Role: "provider"}, http.StatusNotFound)
+	s.do(t, http.MethodPut, "/v1/provider/accounts/cust2/roles", provider, dto.RoleGrant{Role: "admin"}, http.StatusBadRequest)
+}
+
+func TestRoutesRequireToken(t *testing.T) {
+	s, customer, provider := session(t)
+
+	const id = "000000000000000000000000"
+	customerRoutes := []struct{ method, path string }{
+		{http.MethodGet, "/v1/customer/products"},
+		{http.MethodGet, "/v1/customer/products/bc01"},
+		{http.MethodGet, "/v1/customer/orders"},
+		{http.MethodGet, "/v1/customer/me/orders"},
+		{http.MethodGet, "/v1/customer/me/orders/active"},
+		{http.MethodGet, "/v1/customer/me/orders/history"},
+		{http.MethodGet, "/v1/customer/orders/" + id},
+		{http.MethodPost, "/v1/customer/orders"},
+		{http.MethodPut, "/v1/customer/orders/" + id + "/cart"},
+		{http.MethodDelete, "/v1/customer/orders/" + id + "/cart"},
+		{http.MethodGet, "/v1/customer/orders/" + id + "/status"},
+		{http.MethodPut, "/v1/customer/orders/" + id + "/status"},
+		{http.MethodPost, "/v1/customer/reviews/orders/" + id},
+		{http.MethodPut, "/v1/customer/reviews/orders/" + id},
+		{http.MethodDelete, "/v1/customer/reviews/orders/" + id},
+		{http.MethodGet, "/v1/customer/reviews/products/bc01"},
+	}
+	providerRoutes := []struct{ method, path string }{
+		{http.MethodPut, "/v1/provider/accounts/cust1/roles"},
+		{http.MethodPost, "/v1/provider/products"},
+		{http.MethodPut, "/v1/provider/products/bc01"},
+		{http.MethodDelete, "/v1/provider/products/bc01"},
+		{http.MethodGet, "/v1/provider/products/bc01/stock"},
+		{http.MethodPut, "/v1/provider/products/bc01/stock"},
+		{http.MethodGet, "/v1/provider/orders"},
+		{http.MethodPut, "/v1/provider/orders/" + id + "/status"},
+		{http.MethodGet, "/v1/provider/reviews/orders"},
+		{http.MethodPut, "/v1/provider/reviews/orders/" + id + "/hidden"},
+	}
+
+	for _, r := range customerRoutes {
+		t.Run(r.method+" "+r.path, func(t *testing.T) {
+			s.expectError(t, r.method, r.path, "", nil, http.StatusUnauthorized, dto.ErrCodeTokenMissing)
+			s.expectError(t, r.method, r.path, "Bearer not.a.token", nil, http.StatusUnauthorized, dto.ErrCodeTokenInvalid)
+			s.expectError(t, r.method, r.path, provider, nil, http.StatusForbidden, dto.ErrCodeInsufficientScope)
+		})
+	}
+	for _, r := range providerRoutes {
+		t.Run(r.method+" "+r.path, func(t *testing.T) {
+			s.expectError(t, r.method, r.path, "", nil, http.StatusUnauthorized, dto.ErrCodeTokenMissing)
+			s.expectError(t, r.method, r.path, "Bearer not.a.token", nil, http.StatusUnauthorized, dto.ErrCodeTokenInvalid)
+			s.expectError(t, r.method, r.path, customer, nil, http.StatusForbidden, dto.ErrCodeInsufficientScope)
+		})
+	}
+}
+
+func TestValidationErrors(t *testing.T) {
+	s, customer, provider := session(t)
+	s.do(t, http.MethodPost, "/v1/provider/products", provider, product("bc01", 10), http.StatusCreated)
+	orderID := s.createOrder(t, customer, map[string]int{"bc01": 1})
+
+	badAddress := user("cust2")
+	badAddress.Address.PostalCode = "1234"
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   interface{}
+	}{
+		{"register without password", http.MethodPost, "/v1/account/register", "", dto.AccountCreate{UserCreate: user("cust2")}},
+		{"register with bad postal code", http.MethodPost, "/v1/account/register", "", dto.AccountCreate{Password: "password1234", UserCreate: badAddress}},
+		{"login without username", http.MethodPost, "/v1/account/login/customer", "", dto.AccountLogin{Password: "password1234"}},
+		{"refresh without token", http.MethodPost, "/v1/account/refresh", "", dto.TokenRefresh{}},
+		{"product without name", http.MethodPost, "/v1/provider/products", provider, dto.ProductCreate{Code: "bc02"}},
+		{"product update without price", http.MethodPut, "/v1/provider/products/bc01", provider, dto.ProductUpdate{Name: "Taco"}},
+		{"negative stock", http.MethodPut, "/v1/provider/products/bc01/stock", provider, dto.StockUpdate{Stock: -1}},
+		{"unknown product sort", http.MethodGet, "/v1/customer/products?sort=price", customer, nil},
+		{"same product sorts", http.MethodGet, "/v1/customer/products?sort=likes&then=likes", customer, nil},
+		{"product page too large", http.MethodGet, "/v1/customer/products?limit=101", customer, nil},
+		{"unknown order state", http.MethodGet, "/v1/customer/orders?state=open", customer, nil},
+		{"unknown order status filter", http.MethodGet, "/v1/provider/orders?status=Open", provider, nil},
+		{"order without cart", http.MethodPost, "/v1/customer/orders", customer, dto.OrderCreate{User: user("cust1")}},
+		{"unknown status", http.MethodPut, "/v1/customer/orders/" + orderID + "/status", customer, dto.OrderUpdateStatus{Status: "Eaten"}},
+		{"cart items not a list", http.MethodDelete, "/v1/customer/orders/" + orderID + "/cart", customer, map[string]int{"bc01": 1}},
+		{"review rating out of range", http.MethodPost, "/v1/customer/reviews/orders/" + orderID, customer, dto.ReviewOrderCreate{Rating: 6}},
+		{"unknown review sort", http.MethodGet, "/v1/customer/reviews/products/bc01?sort=oldest", customer, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.do(t, tt.method, tt.path, tt.token, tt.body, http.StatusBadRequest)
+		})
+	}
+
+	s.expectError(t, http.MethodGet, "/v1/customer/products?cursor=garbage", customer, nil, http.StatusBadRequest, dto.ErrCodeInvalidCursor)
+	s.expectError(t, http.MethodGet, "/v1/provider/orders?cursor=garbage", provider, nil, http.StatusBadRequest, dto.ErrCodeInvalidCursor)
+	s.expectError(t, http.MethodGet, "/v1/provider/reviews/orders?cursor=garbage", provider, nil, http.StatusBadRequest, dto.ErrCodeInvalidCursor)
+	s.expectError(t, http.MethodPut, "/v1/customer/orders/"+orderID+"/cart", customer, dto.OrderUpdateCart{Cart: map[string]int{"bc01": 11}}, http.StatusBadRequest, dto.ErrCodeInvalidCart)
+	s.expectError(t, http.MethodPost, "/v1/customer/orders", customer, dto.OrderCreate{
+		User:            user("cust1"),
+		OrderUpdateCart: dto.OrderUpdateCart{Cart: map[string]int{"nope": 1}},
+	}, http.StatusBadRequest, dto.ErrCodeInvalidCart)
+}
+
+func TestProductRoutes(t *testing.T) {
+	s, customer, provider := session(t)
+
+	s.do(t, http.MethodPost, "/v1/provider/products", provider, product("bc01", 10), http.StatusCreated)
+
+	update := product("bc01", 20).ProductUpdate
+	update.Name = "Beef burrito"
+	s.do(t, http.MethodPut, "/v1/provider/products/bc01", provider, update, http.StatusOK)
+
+	response := s.do(t, http.MethodGet, "/v1/customer/products/bc01", customer, nil, http.StatusOK)
+	var got struct {
+		Code string `json:"code"`
+		Name string `json:"name"`
+	}
+	decode(t, response, &got)
+	if got.Code != "bc01" || got.Name != "Beef burrito" {
+		t.Errorf("product = %+v, want bc01 Beef burrito", got)
+	}
+
+	// Customers see neither the stock nor who ordered what.
+	var fields map[string]json.RawMessage
+	decode(t, response, &fields)
+	for _, field := range []string{"stock", "userOrders"} {
+		if _, ok := fields[field]; ok {
+			t.Errorf("product has %s: %s", field, response.Data)
+		}
+	}
+
+	var page struct {
+		Items []struct {
+			Code string `json:"code"`
+		} `json:"items"`
+	}
+	decode(t, s.do(t, http.MethodGet, "/v1/customer/products?sort=ratings&then=time&order=desc&orderable=true", customer, nil, http.StatusOK), &page)
+	if len(page.Items) != 1 || page.Items[0].Code != "bc01" {
+		t.Errorf("products = %+v, want bc01", page.Items)
+	}
+
+	s.do(t, http.MethodPut, "/v1/provider/products/bc01/stock", provider, dto.StockUpdate{Stock: 5}, http.StatusOK)
+	var stock struct {
+		Stock int `json:"stock"`
+	}
+	decode(t, s.do(t, http.MethodGet, "/v1/provider/products/bc01/stock", provider, nil, http.StatusOK), &stock)
+	if stock.Stock != 5 {
+		t.Errorf("stock = %d, want 5", stock.Stock)
+	}
+	s.do(t, http.MethodGet, "/v1/provider/products/nope/stock", provider, nil, http.StatusNotFound)
+	s.do(t, http.MethodPut, "/v1/provider/products/nope/stock", provider, dto.StockUpdate{Stock: 5}, http.StatusNotFound)
+
+	s.do(t, http.MethodDelete, "/v1/provider/products/bc01", provider, nil, http.StatusOK)
+	s.do(t, http.MethodGet, "/v1/customer/products/bc01", customer, nil, http.StatusNotFound)
+	decode(t, s.do(t, http.MethodGet, "/v1/customer/products", customer, nil, http.StatusOK), &page)
+	if len(page.Items) != 0 {
+		t.Errorf("products = %+v after delete, want none", page.Items)
+	}
+}
+
+func TestOrderLifecycle(t *testing.T) {
+	s, customer, provider := session(t)
+	s.register(t, "cust2")
+	other, _ := s.login(t, "cust2", "customer")
+
+	s.do(t, http.MethodPost, "/v1/provider/products", provider, product("bc01", 10), http.StatusCreated)
+	s.do(t, http.MethodPost, "/v1/provider/products", provider, product("bc02", 10), http.StatusCreated)
+
+	// Create and edit the cart
+	s.expectError(t, http.MethodPost, "/v1/customer/orders", other, dto.OrderCreate{
+		User:            user("cust1"),
+		OrderUpdateCart: dto.OrderUpdateCart{Cart: map[string]int{"bc01": 1}},
+	}, http.StatusForbidden, dto.ErrCodeNotOwner)
+
+	orderID := s.createOrder(t, customer, map[string]int{"bc01": 1})
+	s.do(t, http.MethodPut, "/v1/customer/orders/"+orderID+"/cart", customer, dto.OrderUpdateCart{Cart: map[string]int{"bc01": 2, "bc02": 1}}, http.StatusOK)
+	s.do(t, http.MethodDelete, "/v1/customer/orders/"+orderID+"/cart", customer, []string{"bc02"}, http.StatusOK)
+
+	var order struct {
+		Status string         `json:"status"`
+		Cart   map[string]int `json:"cart"`
+		Total  float64        `json:"total"`
+	}
+	decode(t, s.do(t, http.MethodGet, "/v1/customer/orders/"+orderID, customer, nil, http.StatusOK), &order)
+	if order.Status != "Submitting" || len(order.Cart) != 1 || order.Cart["bc01"] != 2 {
+		t.Errorf("order = %+v, want Submitting with 2 bc01", order)
+	}
+
+	s.expectError(t, http.MethodGet, "/v1/customer/orders/"+orderID, other, nil, http.StatusForbidden, dto.ErrCodeNotOwner)
+	s.expectError(t, http.MethodPut, "/v1/customer/orders/"+orderID+"/cart", other, dto.OrderUpdateCart{Cart: map[string]int{"bc01": 1}}, http.StatusForbidden, dto.ErrCodeNotOwner)
+	s.expectError(t, http.MethodDelete, "/v1/customer/orders/"+orderID+"/cart", other, []string{"bc01"}, http.StatusForbidden, dto.ErrCodeNotOwner)
+	s.expectError(t, http.MethodGet, "/v1/customer/orders/"+orderID+"/status", other, nil, http.StatusForbidden, dto.ErrCodeNotOwner)
+	s.expectError(t, http.MethodPut, "/v1/customer/orders/"+orderID+"/status", other, dto.OrderUpdateStatus{Status: "Submitted"}, http.StatusForbidden, dto.ErrCodeNotOwner)
+	s.do(t, http.MethodGet, "/v1/customer/orders/000000000000000000000000", customer, nil, http.StatusNotFound)
+	s.do(t, http.MethodPut, "/v1/provider/orders/000000000000000000000000/status", provider, dto.OrderUpdateStatus{Status: "Cooking"}, http.StatusNotFound)
+
+	// Walk the order to Delivered
+	s.expectError(t, http.MethodPut, "/v1/provider/orders/"+orderID+"/status", provider, dto.OrderUpdateStatus{Status: "Submitted"}, http.StatusForbidden, dto.ErrCodeTransitionNotPermitted)
+	s.setStatus(t, "customer", customer, orderID, "Submitted", http.StatusOK)
+	s.expectError(t, http.MethodPut, "/v1/customer/orders/"+orderID+"/status", customer, dto.OrderUpdateStatus{Status: "Cooking"}, http.StatusForbidden, dto.ErrCodeTransitionNotPermitted)
+	s.expectError(t, http.MethodPost, "/v1/customer/reviews/orders/"+orderID, customer, dto.ReviewOrderCreate{Rating: 4}, http.StatusConflict, dto.ErrCodeOrderNotDelivered)
+	s.setStatus(t, "provider", provider, orderID, "Cooking", http.StatusOK)
+	s.expectError(t, http.MethodPut, "/v1/customer/orders/"+orderID+"/status", customer, dto.OrderUpdateStatus{Status: "Cancelled"}, http.StatusConflict, dto.ErrCodeIllegalTransition)
+	s.expectError(t, http.MethodPut, "/v1/provider/orders/"+orderID+"/status", provider, dto.OrderUpdateStatus{Status: "Delivered"}, http.StatusConflict, dto.ErrCodeIllegalTransition)
+
+	var page struct {
+		Items []struct {
+			ID string `json:"id"`
+		} `json:"items"`
+	}
+	decode(t, s.do(t, http.MethodGet, "/v1/customer/me/orders/active", customer, nil, http.StatusOK), &page)
+	if len(page.Items) != 1 || page.Items[0].ID != orderID {
+		t.Errorf("active orders = %+v, want %s", page.Items, orderID)
+	}
+
+	s.setStatus(t, "provider", provider, orderID, "Cooked", http.StatusOK)
+	s.setStatus(t, "provider", provider, orderID, "Delivering", http.StatusOK)
+	s.setStatus(t, "provider", provider, orderID, "Delivered", http.StatusOK)
+
+	var status struct {
+		Status  string `json:"status"`
+		History []struct {
+			Status string `json:"status"`
+		} `json:"history"`
+	}
+	decode(t, s.do(t, http.MethodGet, "/v1/customer/orders/"+orderID+"/status", customer, nil, http.StatusOK), &status)
+	if status.Status != "Delivered" || len(status.History) != 6 {
+		t.Errorf("status = %+v, want Delivered after 6 changes", status)
+	}
+
+	// The order lists
+	for _, path := range []string{
+		"/v1/customer/orders?state=history",
+		"/v1/customer/me/orders?state=history",
+		"/v1/customer/me/orders/history",
+		"/v1/provider/orders?status=Delivered&username=cust1",
+	} {
+		token := customer
+		if path[4] == 'p' {
+			token = provider
+		}
+		decode(t, s.do(t, http.MethodGet, path, token, nil, http.StatusOK), &page)
+		if len(page.Items) != 1 || page.Items[0].ID != orderID {
+			t.Errorf("%s = %+v, want %s", path, page.Items, orderID)
+		}
+	}
+	decode(t, s.do(t, http.MethodGet, "/v1/customer/me/orders/active", customer, nil, http.StatusOK), &page)
+	if len(page.Items) != 0 {
+		t.Errorf("active orders = %+v after delivery, want none", page.Items)
+	}
+	decode(t, s.do(t, http.MethodGet, "/v1/customer/orders", other, nil, http.StatusOK), &page)
+	if len(page.Items) != 0 {
+		t.Errorf("orders of cust2 = %+v, want none", page.Items)
+	}
+
+	// Review the order
+	review := dto.ReviewOrderCreate{
+		Rating:  4,
+		Comment: "Incredible!",
+		ReviewProducts: []dto.ReviewProductCreate{
+			{ProductCode: "bc01", IsLiked: true, Rating: 5, Comment: "Good!"},
+		},
+	}
+	s.expectError(t, http.MethodPost, "/v1/customer/reviews/orders/"+orderID, other, review, http.StatusForbidden, dto.ErrCodeNotOwner)
+	s.expectError(t, http.MethodPost, "/v1/customer/reviews/orders/"+orderID, customer, dto.ReviewOrderCreate{
+		Rating:         4,
+		ReviewProducts: []dto.ReviewProductCreate{{ProductCode: "bc02", IsLiked: true}},
+	}, http.StatusBadRequest, dto.ErrCodeProductNotInOrder)
+	s.do(t, http.MethodPost, "/v1/customer/reviews/orders/"+orderID, customer, review, http.StatusCreated)
+	s.expectError(t, http.MethodPost, "/v1/customer/reviews/orders/"+orderID, customer, review, http.StatusConflict, dto.ErrCodeReviewExists)
+
+	review.Rating = 3
+	review.Comment = "Good enough"
+	s.do(t, http.MethodPut, "/v1/customer/reviews/orders/"+orderID, customer, review, http.StatusOK)
+
+	var reviews struct {
+		Items []struct {
+			Username string  `json:"username"`
+			Rating   float64 `json:"rating"`
+		} `json:"items"`
+	}
+	decode(t, s.do(t, http.MethodGet, "/v1/customer/reviews/products/bc01?sort=highest&withComment=true", customer, nil, http.StatusOK), &reviews)
+	if len(reviews.Items) != 1 || reviews.Items[0].Username != "cust1" {
+		t.Errorf("product reviews = %+v, want one by cust1", reviews.Items)
+	}
+
+	var orderReviews struct {
+		Items []struct {
+			OrderID string `json:"orderID"`
+			Hidden  bool   `json:"hidden"`
+		} `json:"items"`
+	}
+	decode(t, s.do(t, http.MethodGet, "/v1/provider/reviews/orders", provider, nil, http.StatusOK), &orderReviews)
+	if len(orderReviews.Items) != 1 || orderReviews.Items[0].OrderID != orderID {
+		t.Errorf("order reviews = %+v, want %s", orderReviews.Items, orderID)
+	}
+
+	s.do(t, http.MethodPut, "/v1/provider/reviews/orders/"+orderID+"/hidden", provider, dto.ReviewUpdateHidden{Hidden: true}, http.StatusOK)
+	s.do(t, http.MethodPut, "/v1/provider/reviews/orders/000000000000000000000000/hidden", provider, dto.ReviewUpdateHidden{Hidden: true}, http.StatusNotFound)
+	decode(t, s.do(t, http.MethodGet, "/v1/customer/reviews/products/bc01", customer, nil, http.StatusOK), &reviews)
+	if len(reviews.Items) != 0 {
+		t.Errorf("product reviews = %+v after hiding, want none", reviews.Items)
+	}
+
+	s.expectError(t, http.MethodDelete, "/v1/customer/reviews/orders/"+orderID, other, nil, http.StatusForbidden, dto.ErrCodeNotOwner)
+	s.do(t, http.MethodDelete, "/v1/customer/reviews/orders/"+orderID, customer, nil, http.StatusOK)
+	s.do(t, http.MethodDelete, "/v1/customer/reviews/orders/"+orderID, customer, nil, http.StatusNotFound)
+	s.do(t, http.MethodPut, "/v1/customer/reviews/orders/"+orderID, customer, review, http.StatusNotFound)
+	decode(t, s.do(t, http.MethodGet, "/v1/provider/reviews/orders", provider, nil, http.StatusOK), &orderReviews)
+	if len(orderReviews.Items) != 0 {
+		t.Errorf("order reviews = %+v after delete, want none", orderReviews.Items)
+	}
+}
+
+func TestCustomerCancelsOrder(t *testing.T) {
+	s, customer, provider := session(t)
+	s.do(t, http.MethodPost, "/v1/provider/products", provider, product("bc01", 10), http.StatusCreated)
+
+	orderID := s.createOrder(t, customer, map[string]int{"bc01": 3})
+	s.setStatus(t, "customer", customer, orderID, "Submitted", http.StatusOK)
+
+	var stock struct {
+		Stock int `json:"stock"`
+	}
+	decode(t, s.do(t, http.MethodGet, "/v1/provider/products/bc01/stock", provider, nil, http.StatusOK), &stock)
+	if stock.Stock != 7 {
+		t.Errorf("stock = %d after submitting, want 7", stock.Stock)
+	}
+
+	s.setStatus(t, "customer", customer, orderID, "Cancelled", http.StatusOK)
+	s.expectError(t, http.MethodPut, "/v1/provider/orders/"+orderID+"/status", provider, dto.OrderUpdateStatus{Status: "Cooking"}, http.StatusConflict, dto.ErrCodeIllegalTransition)
+
+	decode(t, s.do(t, http.MethodGet, "/v1/provider/products/bc01/stock", provider, nil, http.StatusOK), &stock)
+	if stock.Stock != 10 {
+		t.Errorf("stock = %d after cancelling, want 10", stock.Stock)
+	}
+}
+
+func TestReload(t *testing.T) {
+	s := newTestServer(t)
+	other := newTestServer(t)
+
+	allowOrigin := func() string {
+		req := httptest.NewRequest(http.MethodOptions, "/v1/customer/products", nil)
+		req.Header.Set("Origin", "https://shop.example")
+		w := httptest.NewRecorder()
+		s.engine.ServeHTTP(w, req)
+		return w.Header().Get("Access-Control-Allow-Origin")
+	}
+	if got := allowOrigin(); got != "*" {
+		t.Fatalf("Access-Control-Allow-Origin = %q before reload, want *", got)
+	}
+
+	cfg := config.Default()
+	cfg.Auth.Secret = "test secret"
+	cfg.CORS.AllowOrigins = []string{"https://other.example"}
+	cfg.Log.Level = "debug"
+	cfg.Server.Port = ":9090"
+
+	warnings, err := s.app.Reload(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"server.port changed but takes a restart to apply"}; !reflect.DeepEqual(warnings, want) {
+		t.Errorf("warnings = %q, want %q", warnings, want)
+	}
+	if got := allowOrigin(); got != "" {
+		t.Errorf("Access-Control-Allow-Origin = %q after reload, want none", got)
+	}
+	if !s.app.Level.Enabled(zap.DebugLevel) {
+		t.Error("debug logging is off after reload")
+	}
+	// Every application has a level of its own.
+	if other.app.Level.Enabled(zap.DebugLevel) {
+		t.Error("reload turned on debug logging of another application")
+	}
+
+	// The port is still pending, so it is reported again.
+	warnings, err = s.app.Reload(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("warnings = %q on second reload, want the port again", warnings)
+	}
+}
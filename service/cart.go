@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"oos/dto"
+	"oos/model"
+)
+
+// CartError reports every cart line that cannot be ordered.
+type CartError struct {
+	Lines []dto.CartLineError
+}
+
+func (e *CartError) Error() string {
+	reasons := make([]string, len(e.Lines))
+	for i, line := range e.Lines {
+		reasons[i] = line.ProductCode + ": " + line.Reason
+	}
+	return "invalid cart: " + strings.Join(reasons, "; ")
+}
+
+// validateCart checks each line against the catalog and returns the products
+// it refers to.
+func (s *Service) validateCart(ctx context.Context, cart map[string]int) (map[string]model.Product, error) {
+	codes := make([]string, 0, len(cart))
+	for productCode := range cart {
+		codes = append(codes, productCode)
+	}
+	sort.Strings(codes)
+
+	products, err := s.findProducts(ctx, codes)
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []dto.CartLineError
+	for _, productCode := range codes {
+		quantity := cart[productCode]
+		product, ok := products[productCode]
+
+		var reason string
+		switch {
+		case quantity <= 0:
+			reason = "quantity must be positive"
+		case !ok:
+			reason = "product does not exist"
+		case !product.CanView || !product.CanOrder:
+			reason = "product cannot be ordered"
+		case quantity > product.Limit:
+			reason = fmt.Sprintf("quantity exceeds the limit of %d", product.Limit)
+		default:
+			continue
+		}
+
+		lines = append(lines, dto.CartLineError{
+			ProductCode: productCode,
+			Quantity:    quantity,
+			Reason:      reason,
+		})
+	}
+
+	if len(lines) > 0 {
+		return nil, &CartError{Lines: lines}
+	}
+
+	return products, nil
+}
+
+// priceCart resolves each cart line to an order item. Lines already in
+// snapshot keep the unit price they were ordered at; others are priced from
+// products, or looked up if missing there.
+func (s *Service) priceCart(ctx context.Context, cart map[string]int, snapshot []model.OrderItem, products map[string]model.Product) ([]model.OrderItem, error) {
+	priced := map[string]model.OrderItem{}
+	for _, item := range snapshot {
+		priced[item.ProductCode] = item
+	}
+
+	var missing []string
+	for productCode := range cart {
+		if _, ok := priced[productCode]; ok {
+			continue
+		}
+		if _, ok := products[productCode]; !ok {
+			missing = append(missing, productCode)
+		}
+	}
+
+	if len(missing) > 0 {
+		found, err := s.findProducts(ctx, missing)
+		if err != nil {
+			return nil, err
+		}
+		for productCode, product := range products {
+			found[productCode] = product
+		}
+		products = found
+	}
+
+	items := make([]model.OrderItem, 0, len(cart))
+	for productCode, quantity := range cart {
+		item, ok := priced[productCode]
+		if !ok {
+			product, ok := products[productCode]
+			if !ok {
+				return nil, fmt.Errorf("product %s not found", productCode)
+			}
+			item = model.OrderItem{
+				ProductCode: product.Code,
+				Name:        product.Name,
+				UnitPrice:   product.Price,
+			}
+		}
+		item.Quantity = quantity
+		item.LineTotal = roundCents(item.UnitPrice * float64(quantity))
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].ProductCode < items[j].ProductCode
+	})
+
+	return items, nil
+}
+
+func (s *Service) findProducts(ctx context.Context, productCodes []string) (map[string]model.Product, error) {
+	products := map[string]model.Product{}
+	if len(productCodes) == 0 {
+		return products, nil
+	}
+
+	documents, err := s.products.FindByCodes(ctx, productCodes)
+	if err != nil {
+		return nil, err
+	}
+	for _, document := range documents {
+		products[document.Code] = document.Product()
+	}
+
+	return products, nil
+}
+
+func (s *Service) setTotals(order *model.Order, items []model.OrderItem) {
+	var subtotal float64
+	for _, item := range items {
+		subtotal += item.LineTotal
+	}
+
+	order.Items = items
+	order.Subtotal = roundCents(subtotal)
+	order.Tax = roundCents(subtotal * s.taxRate)
+	order.DeliveryFee = 0
+	if len(items) > 0 {
+		order.DeliveryFee = s.deliveryFee
+	}
+	order.Total = roundCents(order.Subtotal + order.Tax + order.DeliveryFee)
+}
+
+func roundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"oos/dto"
+	"oos/model"
+	"oos/repository"
+)
+
+func TestCreateOrderValidatesCart(t *testing.T) {
+	ctx := context.Background()
+	repos := repository.NewMemory()
+	s := newTestService(repos)
+	createProduct(t, s, "a1", 2.5, 5)
+	createProduct(t, s, "a2", 2.5, 5)
+	createProduct(t, s, "c1", 2.5, 5)
+	createProduct(t, s, "h1", 2.5, 5)
+	if _, err := s.UpdateProduct(ctx, "c1", dto.ProductUpdate{Name: "c1", Origin: "Korea", Price: 2.5, Limit: 5, CanOrder: false, CanView: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.DeleteProduct(ctx, "h1"); err != nil {
+		t.Fatal(err)
+	}
+
+	params := dto.OrderCreate{
+		User:            dto.UserCreate{Username: "abc1"},
+		OrderUpdateCart: dto.OrderUpdateCart{Cart: map[string]int{"a1": 6, "a2": 0, "b9": 1, "c1": 1, "h1": 1}},
+	}
+	_, err := s.CreateOrder(ctx, params)
+
+	var cartErr *CartError
+	if !errors.As(err, &cartErr) {
+		t.Fatalf("err = %v, want a cart error", err)
+	}
+	want := []dto.CartLineError{
+		{ProductCode: "a1", Quantity: 6, Reason: "quantity exceeds the limit of 5"},
+		{ProductCode: "a2", Quantity: 0, Reason: "quantity must be positive"},
+		{ProductCode: "b9", Quantity: 1, Reason: "product does not exist"},
+		{ProductCode: "c1", Quantity: 1, Reason: "product cannot be ordered"},
+		{ProductCode: "h1", Quantity: 1, Reason: "product cannot be ordered"},
+	}
+	if !reflect.DeepEqual(cartErr.Lines, want) {
+		t.Errorf("lines = %+v, want %+v", cartErr.Lines, want)
+	}
+
+	for _, code := range []string{"a1", "a2", "c1", "h1"} {
+		if stock := getProduct(t, repos, code).Stock; stock != 5 {
+			t.Errorf("%s stock = %d, want 5", code, stock)
+		}
+	}
+}
+
+func TestCreateOrderTotals(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(repository.NewMemory())
+	createProduct(t, s, "a1", 2.5, 5)
+	createProduct(t, s, "b1", 1.99, 5)
+
+	order, err := s.GetOrder(ctx, createOrder(t, s, map[string]int{"b1": 2, "a1": 3}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantItems := []model.OrderItem{
+		{ProductCode: "a1", Name: "a1", UnitPrice: 2.5, Quantity: 3, LineTotal: 7.5},
+		{ProductCode: "b1", Name: "b1", UnitPrice: 1.99, Quantity: 2, LineTotal: 3.98},
+	}
+	if !reflect.DeepEqual(order.Items, wantItems) {
+		t.Errorf("items = %+v, want %+v", order.Items, wantItems)
+	}
+	// 11.48 with 10% tax rounded to the cent and a delivery fee of 3.
+	if order.Subtotal != 11.48 || order.Tax != 1.15 || order.DeliveryFee != 3 || order.Total != 15.63 {
+		t.Errorf("totals = %v + %v + %v = %v, want 11.48 + 1.15 + 3 = 15.63", order.Subtotal, order.Tax, order.DeliveryFee, order.Total)
+	}
+}
+
+func TestUpdateOrderItemsKeepsOrderedPrices(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(repository.NewMemory())
+	createProduct(t, s, "a1", 2.5, 5)
+	createProduct(t, s, "b1", 1, 5)
+	orderID := createOrder(t, s, map[string]int{"a1": 1})
+
+	// A new price applies to lines added from now on, not to a1.
+	for _, code := range []string{"a1", "b1"} {
+		if _, err := s.UpdateProduct(ctx, code, dto.ProductUpdate{Name: code, Origin: "Korea", Price: 4, Limit: 5, CanOrder: true, CanView: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.UpdateOrderItems(ctx, orderID, dto.OrderUpdateCart{Cart: map[string]int{"a1": 2, "b1": 1}}); err != nil {
+		t.Fatal(err)
+	}
+
+	order, err := s.GetOrder(ctx, orderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantItems := []model.OrderItem{
+		{ProductCode: "a1", Name: "a1", UnitPrice: 2.5, Quantity: 2, LineTotal: 5},
+		{ProductCode: "b1", Name: "b1", UnitPrice: 4, Quantity: 1, LineTotal: 4},
+	}
+	if !reflect.DeepEqual(order.Items, wantItems) {
+		t.Errorf("items = %+v, want %+v", order.Items, wantItems)
+	}
+	if order.Subtotal != 9 || order.Total != 12.9 {
+		t.Errorf("subtotal %v and total %v, want 9 and 12.9", order.Subtotal, order.Total)
+	}
+}
@@ -3,219 +3,275 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
+	"sort"
 	"time"
 
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 
-	"oos/db"
 	"oos/dto"
 	"oos/model"
+	"oos/repository"
 )
 
-func CreateOrder(ctx context.Context, params dto.OrderCreate) (*mongo.InsertOneResult, error) {
+var (
+	ErrIllegalTransition      = errors.New("illegal order status transition")
+	ErrTransitionNotPermitted = errors.New("order status transition not permitted for this role")
+)
+
+func (s *Service) CreateOrder(ctx context.Context, params dto.OrderCreate) (*mongo.InsertOneResult, error) {
+	now := time.Now().UnixMicro()
 	order := model.Order{
 		ID:        primitive.NewObjectID(),
-		CreatedAt: time.Now().UnixMicro(),
-		UpdatedAt: time.Now().UnixMicro(),
+		CreatedAt: now,
+		UpdatedAt: now,
 		Status:    "Submitting",
-		User:      params.User,
-		Cart:      params.Cart,
+		StatusHistory: []model.OrderStatusChange{{
+			Status:    "Submitting",
+			ChangedAt: now,
+			Actor:     params.User.Username,
+		}},
+		User: params.User,
+		Cart: params.Cart,
 	}
 
-	result, err := db.OrderCollection.InsertOne(ctx, order)
+	products, err := s.validateCart(ctx, order.Cart)
 	if err != nil {
 		return nil, err
 	}
 
-	return result, nil
-}
-
-func ListOrders(ctx context.Context) ([]model.Order, error) {
-	filter := bson.D{}
-	opts := options.Find().SetSort(bson.M{"createdAt": 1})
-
-	cursor, err := db.OrderCollection.Find(ctx, filter, opts)
+	items, err := s.priceCart(ctx, order.Cart, nil, products)
 	if err != nil {
 		return nil, err
 	}
-	defer cursor.Close(ctx)
+	s.setTotals(&order, items)
 
-	var orders []model.Order
-	for cursor.Next(ctx) {
-		var order model.Order
-		if err := cursor.Decode(&order); err != nil {
+	result, err := s.transactor.WithTransaction(ctx, func(ctx context.Context) (interface{}, error) {
+		if err := s.reserveStock(ctx, order.Cart); err != nil {
 			return nil, err
 		}
-		orders = append(orders, order)
+
+		return s.orders.Insert(ctx, order)
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return orders, nil
+	return result.(*mongo.InsertOneResult), nil
 }
 
-func ListOrdersActive(ctx context.Context, username string) ([]model.Order, error) {
-	filter := bson.M{"user.username": username}
-	opts := options.Find().SetSort(bson.M{"createdAt": 1})
+func (s *Service) ListOrders(ctx context.Context, query dto.OrderQuery) (*dto.Page, error) {
+	filter := repository.OrderFilter{
+		Username: query.Username,
+		Statuses: query.Status,
+	}
+	if !query.From.IsZero() {
+		filter.CreatedFrom = query.From.UnixMicro()
+	}
+	if !query.To.IsZero() {
+		filter.CreatedTo = query.To.UnixMicro()
+	}
 
-	cursor, err := db.OrderCollection.Find(ctx, filter, opts)
-	if err != nil {
-		return nil, err
+	return s.orders.List(ctx, filter, query.PageQuery)
+}
+
+// ListCustomerOrders lists the orders of a customer in the given state:
+// active orders are not delivered or cancelled yet, and history is the rest.
+func (s *Service) ListCustomerOrders(ctx context.Context, username string, query dto.CustomerOrderQuery) (*dto.Page, error) {
+	filter := repository.OrderFilter{Username: username}
+	switch query.State {
+	case "active":
+		filter.Statuses = statusesBefore("Delivered")
+	case "history":
+		filter.ExcludeStatuses = statusesBefore("Delivered")
 	}
-	defer cursor.Close(ctx)
 
-	var orders []model.Order
-	for cursor.Next(ctx) {
-		var order model.Order
-		if err = cursor.Decode(&order); err != nil {
-			return nil, err
-		}
-		if model.OrderStatus[order.Status] < model.OrderStatus["Delivered"] {
-			orders = append(orders, order)
+	return s.orders.List(ctx, filter, query.PageQuery)
+}
+
+// statusesBefore lists the order statuses that come before status.
+func statusesBefore(status string) []string {
+	var statuses []string
+	for s, ordinal := range model.OrderStatus {
+		if ordinal < model.OrderStatus[status] {
+			statuses = append(statuses, s)
 		}
 	}
-
-	return orders, nil
+	sort.Strings(statuses)
+	return statuses
 }
 
-func ListOrdersHistory(ctx context.Context, username string) ([]model.Order, error) {
-	filter := bson.M{"user.username": username}
-	opts := options.Find().SetSort(bson.M{"createdAt": 1})
+func (s *Service) GetOrder(ctx context.Context, orderID string) (*model.Order, error) {
+	return s.orders.Get(ctx, orderID)
+}
 
-	cursor, err := db.OrderCollection.Find(ctx, filter, opts)
+func (s *Service) GetOrderStatus(ctx context.Context, orderID string) (*model.OrderTimeline, error) {
+	order, err := s.GetOrder(ctx, orderID)
 	if err != nil {
 		return nil, err
 	}
-	defer cursor.Close(ctx)
 
-	var orders []model.Order
-	for cursor.Next(ctx) {
-		var order model.Order
-		if err = cursor.Decode(&order); err != nil {
-			return nil, err
-		}
-		if model.OrderStatus[order.Status] >= model.OrderStatus["Delivered"] {
-			orders = append(orders, order)
-		}
+	changedAt := map[string]int64{}
+	for _, change := range order.StatusHistory {
+		changedAt[change.Status] = change.ChangedAt
 	}
 
-	return orders, nil
-}
+	timeline := model.OrderTimeline{
+		Status:           order.Status,
+		History:          order.StatusHistory,
+		PrepDuration:     stageDuration(changedAt, "Cooking", "Cooked"),
+		DeliveryDuration: stageDuration(changedAt, "Delivering", "Delivered"),
+	}
+	if timeline.History == nil {
+		timeline.History = []model.OrderStatusChange{}
+	}
 
-func GetOrder(ctx context.Context, orderID string) (*model.Order, error) {
-	orderIDObject, _ := primitive.ObjectIDFromHex(orderID)
-	filter := bson.M{"_id": orderIDObject}
+	return &timeline, nil
+}
 
-	var order model.Order
-	if err := db.OrderCollection.FindOne(ctx, filter).Decode(&order); err != nil {
-		return nil, err
+// stageDuration returns the seconds between two statuses, or nil if the order
+// has not reached both.
+func stageDuration(changedAt map[string]int64, from string, to string) *int64 {
+	start, ok := changedAt[from]
+	if !ok {
+		return nil
+	}
+	end, ok := changedAt[to]
+	if !ok {
+		return nil
 	}
 
-	return &order, nil
+	seconds := (end - start) / int64(time.Second/time.Microsecond)
+	return &seconds
 }
 
-func GetOrderStatus(ctx context.Context, orderID string) (*string, error) {
-	orderIDObject, _ := primitive.ObjectIDFromHex(orderID)
-	filter := bson.M{"_id": orderIDObject}
+func (s *Service) UpdateOrderStatus(ctx context.Context, orderID string, role string, actor string, params dto.OrderUpdateStatus) (*mongo.UpdateResult, error) {
+	result, err := s.transactor.WithTransaction(ctx, func(ctx context.Context) (interface{}, error) {
+		order, err := s.GetOrder(ctx, orderID)
+		if err != nil {
+			return nil, err
+		}
 
-	var order model.Order
-	if err := db.OrderCollection.FindOne(ctx, filter).Decode(&order); err != nil {
-		return nil, err
-	}
+		allowedRole, ok := model.OrderTransitions[order.Status][params.Status]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s to %s", ErrIllegalTransition, order.Status, params.Status)
+		}
+		if allowedRole != role {
+			return nil, fmt.Errorf("%w: %s to %s requires %s", ErrTransitionNotPermitted, order.Status, params.Status, allowedRole)
+		}
 
-	return &order.Status, nil
-}
+		result, err := s.orders.UpdateStatus(ctx, orderID, model.OrderStatusChange{
+			Status:    params.Status,
+			ChangedAt: time.Now().UnixMicro(),
+			Actor:     actor,
+			Note:      params.Note,
+		})
+		if err != nil {
+			return nil, err
+		}
 
-func UpdateOrderStatus(ctx context.Context, orderID string, params dto.OrderUpdateStatus) (*mongo.UpdateResult, error) {
-	orderIDObject, _ := primitive.ObjectIDFromHex(orderID)
-	filter := bson.M{"_id": orderIDObject}
-	update := bson.M{"$set": bson.M{
-		"status":    params.Status,
-		"updatedAt": time.Now().UnixMicro(),
-	}}
+		if params.Status == "Cancelled" {
+			if err := s.releaseStock(ctx, order.Cart); err != nil {
+				return nil, err
+			}
+		}
 
-	result, err := db.OrderCollection.UpdateOne(ctx, filter, update)
+		return result, nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	if result.MatchedCount != 1 {
-		return nil, errors.New("no match to update")
-	}
 
-	return result, nil
+	return result.(*mongo.UpdateResult), nil
 }
 
-func UpdateOrderItems(ctx context.Context, orderID string, params dto.OrderUpdateCart) (*mongo.UpdateResult, error) {
-	orderStatus, err := GetOrderStatus(ctx, orderID)
-	if err != nil {
-		return nil, err
-	}
-	if model.OrderStatus[*orderStatus] >= model.OrderStatus["Delivering"] {
-		return nil, errors.New("order change not allowed at this stage")
-	}
+func (s *Service) UpdateOrderItems(ctx context.Context, orderID string, params dto.OrderUpdateCart) (*mongo.UpdateResult, error) {
+	result, err := s.transactor.WithTransaction(ctx, func(ctx context.Context) (interface{}, error) {
+		order, err := s.GetOrder(ctx, orderID)
+		if err != nil {
+			return nil, err
+		}
+		if model.OrderStatus[order.Status] >= model.OrderStatus["Delivering"] {
+			return nil, errors.New("order change not allowed at this stage")
+		}
 
-	orderIDObject, _ := primitive.ObjectIDFromHex(orderID)
-	filter := bson.M{"_id": orderIDObject}
+		products, err := s.validateCart(ctx, params.Cart)
+		if err != nil {
+			return nil, err
+		}
 
-	var order model.Order
-	if err = db.OrderCollection.FindOne(ctx, filter).Decode(&order); err != nil {
-		return nil, err
-	}
+		before := order.Cart
+		order.Cart = map[string]int{}
+		for productCode, quantity := range before {
+			order.Cart[productCode] = quantity
+		}
+		for productCode, quantity := range params.Cart {
+			order.Cart[productCode] = quantity
+		}
 
-	for productCode, quantity := range params.Cart {
-		order.Cart[productCode] = quantity
-	}
+		items, err := s.priceCart(ctx, order.Cart, order.Items, products)
+		if err != nil {
+			return nil, err
+		}
+		s.setTotals(order, items)
 
-	update := bson.M{"$set": bson.M{
-		"cart":      order.Cart,
-		"updatedAt": time.Now().UnixMicro(),
-	}}
+		if err := s.adjustStock(ctx, before, order.Cart); err != nil {
+			return nil, err
+		}
+
+		result, err := s.orders.UpdateCart(ctx, *order, time.Now().UnixMicro())
+		if err != nil {
+			return nil, err
+		}
 
-	result, err := db.OrderCollection.UpdateOne(ctx, filter, update)
+		return result, nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	if result.MatchedCount != 1 {
-		return nil, errors.New("no match to update")
-	}
 
-	return result, nil
+	return result.(*mongo.UpdateResult), nil
 }
 
-func DeleteOrderItems(ctx context.Context, orderID string, params []string) (*mongo.UpdateResult, error) {
-	orderStatus, err := GetOrderStatus(ctx, orderID)
-	if err != nil {
-		return nil, err
-	}
-	if model.OrderStatus[*orderStatus] >= model.OrderStatus["Cooking"] {
-		return nil, errors.New("order change not allowed at this stage")
-	}
+func (s *Service) DeleteOrderItems(ctx context.Context, orderID string, params []string) (*mongo.UpdateResult, error) {
+	result, err := s.transactor.WithTransaction(ctx, func(ctx context.Context) (interface{}, error) {
+		order, err := s.GetOrder(ctx, orderID)
+		if err != nil {
+			return nil, err
+		}
+		if model.OrderStatus[order.Status] >= model.OrderStatus["Cooking"] {
+			return nil, errors.New("order change not allowed at this stage")
+		}
 
-	orderIDObject, _ := primitive.ObjectIDFromHex(orderID)
-	filter := bson.M{"_id": orderIDObject}
+		removed := map[string]int{}
+		for _, productCode := range params {
+			if quantity, ok := order.Cart[productCode]; ok {
+				removed[productCode] = quantity
+			}
+			delete(order.Cart, productCode)
+		}
 
-	var order model.Order
-	if err = db.OrderCollection.FindOne(ctx, filter).Decode(&order); err != nil {
-		return nil, err
-	}
+		items, err := s.priceCart(ctx, order.Cart, order.Items, nil)
+		if err != nil {
+			return nil, err
+		}
+		s.setTotals(order, items)
 
-	for _, productCode := range params {
-		delete(order.Cart, productCode)
-	}
+		result, err := s.orders.UpdateCart(ctx, *order, time.Now().UnixMicro())
+		if err != nil {
+			return nil, err
+		}
 
-	update := bson.M{"$set": bson.M{
-		"cart":      order.Cart,
-		"updatedAt": time.Now().UnixMicro(),
-	}}
+		if err := s.releaseStock(ctx, removed); err != nil {
+			return nil, err
+		}
 
-	result, err := db.OrderCollection.UpdateOne(ctx, filter, update)
+		return result, nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	if result.MatchedCount != 1 {
-		return nil, errors.New("no match to delete")
-	}
 
-	return result, nil
+	return result.(*mongo.UpdateResult), nil
 }
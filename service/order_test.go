@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+
+	"oos/dto"
+	"oos/model"
+	"oos/repository"
+)
+
+func TestUpdateOrderStatusTransitions(t *testing.T) {
+	// Every legal move and the only role that may make it.
+	legal := map[[2]string]string{
+		{"Submitting", "Submitted"}: "customer",
+		{"Submitting", "Cancelled"}: "customer",
+		{"Submitted", "Cooking"}:    "provider",
+		{"Submitted", "Cancelled"}:  "customer",
+		{"Cooking", "Cooked"}:       "provider",
+		{"Cooked", "Delivering"}:    "provider",
+		{"Delivering", "Delivered"}: "provider",
+	}
+
+	statuses := make([]string, 0, len(model.OrderStatus))
+	for status := range model.OrderStatus {
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return model.OrderStatus[statuses[i]] < model.OrderStatus[statuses[j]]
+	})
+
+	ctx := context.Background()
+	repos := repository.NewMemory()
+	s := newTestService(repos)
+
+	for _, from := range statuses {
+		for _, to := range statuses {
+			for _, role := range []string{"customer", "provider"} {
+				allowedRole, ok := legal[[2]string{from, to}]
+				var want error
+				switch {
+				case !ok:
+					want = ErrIllegalTransition
+				case allowedRole != role:
+					want = ErrTransitionNotPermitted
+				}
+
+				t.Run(from+" to "+to+" by "+role, func(t *testing.T) {
+					orderID := insertOrder(t, repos, from, map[string]int{})
+
+					_, err := s.UpdateOrderStatus(ctx, orderID, role, "actor1", dto.OrderUpdateStatus{Status: to})
+					if !errors.Is(err, want) {
+						t.Fatalf("err = %v, want %v", err, want)
+					}
+
+					order, err := s.GetOrder(ctx, orderID)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if want != nil {
+						if order.Status != from || len(order.StatusHistory) != 1 {
+							t.Errorf("rejected move changed the order to %s with %d changes", order.Status, len(order.StatusHistory))
+						}
+						return
+					}
+					last := order.StatusHistory[len(order.StatusHistory)-1]
+					if order.Status != to || last.Status != to || last.Actor != "actor1" {
+						t.Errorf("order is %s with last change %+v, want %s by actor1", order.Status, last, to)
+					}
+				})
+			}
+		}
+	}
+}
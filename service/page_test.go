@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"oos/dto"
+	"oos/model"
+	"oos/repository"
+)
+
+func orderStatuses(page *dto.Page) []string {
+	statuses := []string{}
+	for _, order := range page.Items.([]model.Order) {
+		statuses = append(statuses, order.Status)
+	}
+	return statuses
+}
+
+func TestListCustomerOrdersPages(t *testing.T) {
+	ctx := context.Background()
+	repos := repository.NewMemory()
+	s := newTestService(repos)
+	for _, status := range []string{"Submitted", "Delivered", "Cooking", "Cancelled", "Delivering"} {
+		insertOrder(t, repos, status, map[string]int{})
+	}
+	// Another customer's order is never listed.
+	other := model.Order{Status: "Submitted", User: dto.UserCreate{Username: "xyz9"}}
+	if _, err := repos.Orders.Insert(ctx, other); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		state string
+		pages [][]string
+	}{
+		{"active", [][]string{{"Submitted", "Cooking"}, {"Delivering"}}},
+		{"history", [][]string{{"Delivered", "Cancelled"}}},
+		{"all", [][]string{{"Submitted", "Delivered"}, {"Cooking", "Cancelled"}, {"Delivering"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.state, func(t *testing.T) {
+			query := dto.CustomerOrderQuery{State: tt.state, PageQuery: dto.PageQuery{Limit: 2, Total: true}}
+			for i, want := range tt.pages {
+				page, err := s.ListCustomerOrders(ctx, "abc1", query)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := orderStatuses(page); !reflect.DeepEqual(got, want) {
+					t.Errorf("page %d = %v, want %v", i, got, want)
+				}
+
+				var n int
+				for _, p := range tt.pages {
+					n += len(p)
+				}
+				if page.Total == nil || *page.Total != int64(n) {
+					t.Errorf("page %d total = %v, want %d", i, page.Total, n)
+				}
+
+				last := i == len(tt.pages)-1
+				if (page.NextCursor == "") != last {
+					t.Fatalf("page %d next cursor = %q", i, page.NextCursor)
+				}
+				query.Cursor = page.NextCursor
+			}
+		})
+	}
+
+	query := dto.CustomerOrderQuery{PageQuery: dto.PageQuery{Cursor: "not a cursor"}}
+	if _, err := s.ListCustomerOrders(ctx, "abc1", query); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("err = %v, want %v", err, ErrInvalidCursor)
+	}
+}
+
+func TestListReviewsProductPages(t *testing.T) {
+	ctx := context.Background()
+	repos := repository.NewMemory()
+	s := newTestService(repos)
+	createProduct(t, s, "a1", 1, 5)
+
+	for _, line := range []dto.ReviewProductCreate{
+		{ProductCode: "a1", Rating: 5},
+		{ProductCode: "a1", Rating: 3, Comment: "ok"},
+		{ProductCode: "a1", Rating: 4, Comment: "good"},
+	} {
+		orderID := insertOrder(t, repos, "Delivered", map[string]int{"a1": 1})
+		review := dto.ReviewOrderCreate{Rating: 1, ReviewProducts: []dto.ReviewProductCreate{line}}
+		if _, err := s.CreateReview(ctx, orderID, review); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		query   dto.ReviewQuery
+		ratings [][]float64
+	}{
+		{"highest", dto.ReviewQuery{Sort: "highest"}, [][]float64{{5, 4}, {3}}},
+		{"lowest", dto.ReviewQuery{Sort: "lowest"}, [][]float64{{3, 4}, {5}}},
+		{"with comment", dto.ReviewQuery{Sort: "highest", WithComment: true}, [][]float64{{4, 3}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := tt.query
+			query.Limit = 2
+			for i, want := range tt.ratings {
+				page, err := s.ListReviewsProduct(ctx, "a1", query)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var got []float64
+				for _, review := range page.Items.([]model.ReviewView) {
+					got = append(got, review.Rating)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("page %d = %v, want %v", i, got, want)
+				}
+
+				if (page.NextCursor == "") != (i == len(tt.ratings)-1) {
+					t.Fatalf("page %d next cursor = %q", i, page.NextCursor)
+				}
+				query.Cursor = page.NextCursor
+			}
+		})
+	}
+}
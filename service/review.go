@@ -3,115 +3,248 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
 
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 
-	"oos/db"
 	"oos/dto"
 	"oos/model"
+	"oos/repository"
 )
 
-func CreateReview(ctx context.Context, orderID string, params dto.ReviewOrderCreate) (*mongo.InsertOneResult, error) {
-	order, err := GetOrder(ctx, orderID)
+var (
+	ErrReviewExists      = errors.New("order already reviewed")
+	ErrOrderNotDelivered = errors.New("order not delivered yet")
+	ErrProductNotInOrder = errors.New("product not in order")
+)
+
+func (s *Service) CreateReview(ctx context.Context, orderID string, params dto.ReviewOrderCreate) (*mongo.InsertOneResult, error) {
+	// The product counters and the review are written together or not at all.
+	result, err := s.transactor.WithTransaction(ctx, func(ctx context.Context) (interface{}, error) {
+		order, err := s.GetOrder(ctx, orderID)
+		if err != nil {
+			return nil, err
+		}
+		if order.Status != "Delivered" {
+			return nil, fmt.Errorf("%w: order is %s", ErrOrderNotDelivered, order.Status)
+		}
+		if err := checkReviewProducts(order, params.ReviewProducts); err != nil {
+			return nil, err
+		}
+
+		review := model.ReviewOrder{
+			CreatedAt: time.Now().UnixMicro(),
+			UpdatedAt: time.Now().UnixMicro(),
+			OrderID:   orderID,
+			Username:  order.User.Username,
+			ReviewOrderCreate: dto.ReviewOrderCreate{
+				Rating:         params.Rating,
+				Comment:        params.Comment,
+				ReviewProducts: params.ReviewProducts,
+			},
+		}
+
+		result, err := s.reviews.Insert(ctx, review)
+		if errors.Is(err, repository.ErrDuplicate) {
+			return nil, ErrReviewExists
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if err := s.countReview(ctx, review, 1); err != nil {
+			return nil, err
+		}
+
+		return result, nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	for _, reviewProduct := range params.ReviewProducts {
-		like := 0
-		if reviewProduct.IsLiked {
-			like = 1
-		}
-		filter := bson.M{"productquery.productcreate.code": reviewProduct.ProductCode}
-		update := bson.M{"$inc": bson.M{
-			"userOrders." + order.User.Username: 1,
-			"productquery.reviewCount":          1,
-			"productquery.ratingSum":            params.Rating,
-			"productquery.likeCount":            like,
-		}}
-		
-		result, err := db.ProductCollection.UpdateOne(ctx, filter, update)
+	return result.(*mongo.InsertOneResult), nil
+}
+
+func (s *Service) GetReview(ctx context.Context, orderID string) (*model.ReviewOrder, error) {
+	return s.reviews.Get(ctx, orderID)
+}
+
+func (s *Service) UpdateReview(ctx context.Context, orderID string, params dto.ReviewOrderCreate) (*mongo.UpdateResult, error) {
+	result, err := s.transactor.WithTransaction(ctx, func(ctx context.Context) (interface{}, error) {
+		review, err := s.GetReview(ctx, orderID)
 		if err != nil {
 			return nil, err
 		}
-		if result.MatchedCount != 1 {
-			return nil, errors.New("no match to update")
+
+		order, err := s.GetOrder(ctx, orderID)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkReviewProducts(order, params.ReviewProducts); err != nil {
+			return nil, err
 		}
-	}
 
-	review := model.ReviewOrder{
-		OrderID:  orderID,
-		Username: order.User.Username,
-		ReviewOrderCreate: dto.ReviewOrderCreate{
-			Rating:         params.Rating,
-			Comment:        params.Comment,
-			ReviewProducts: params.ReviewProducts,
-		},
-	}
+		// Hidden reviews are not counted, so there is nothing to correct.
+		if !review.Hidden {
+			if err := s.countReview(ctx, *review, -1); err != nil {
+				return nil, err
+			}
+		}
 
-	result, err := db.ReviewCollection.InsertOne(ctx, review)
+		review.UpdatedAt = time.Now().UnixMicro()
+		review.ReviewOrderCreate = params
+
+		result, err := s.reviews.Replace(ctx, *review)
+		if err != nil {
+			return nil, err
+		}
+
+		if !review.Hidden {
+			if err := s.countReview(ctx, *review, 1); err != nil {
+				return nil, err
+			}
+		}
+
+		return result, nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	return result, nil
+	return result.(*mongo.UpdateResult), nil
 }
 
-func ListReviews(ctx context.Context) ([]model.ReviewOrder, error) {
-	filter := bson.D{}
-	opts := options.Find().SetSort(bson.M{"orderID": 1})
+func (s *Service) DeleteReview(ctx context.Context, orderID string) (*mongo.DeleteResult, error) {
+	result, err := s.transactor.WithTransaction(ctx, func(ctx context.Context) (interface{}, error) {
+		review, err := s.GetReview(ctx, orderID)
+		if err != nil {
+			return nil, err
+		}
+
+		result, err := s.reviews.Delete(ctx, orderID)
+		if err != nil {
+			return nil, err
+		}
 
-	cursor, err := db.ReviewCollection.Find(ctx, filter, opts)
+		if !review.Hidden {
+			if err := s.countReview(ctx, *review, -1); err != nil {
+				return nil, err
+			}
+		}
+
+		return result, nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	defer cursor.Close(ctx)
 
-	var reviews []model.ReviewOrder
-	for cursor.Next(ctx) {
-		var review model.ReviewOrder
-		if err = cursor.Decode(&review); err != nil {
+	return result.(*mongo.DeleteResult), nil
+}
+
+// HideReview hides or unhides a review. A hidden review is taken out of the
+// product aggregates and put back when it is unhidden.
+func (s *Service) HideReview(ctx context.Context, orderID string, params dto.ReviewUpdateHidden) (*mongo.UpdateResult, error) {
+	result, err := s.transactor.WithTransaction(ctx, func(ctx context.Context) (interface{}, error) {
+		review, err := s.GetReview(ctx, orderID)
+		if err != nil {
 			return nil, err
 		}
-		reviews = append(reviews, review)
-	}
 
-	return reviews, nil
-}
+		// A repeated request changes nothing.
+		result, err := s.reviews.SetHidden(ctx, orderID, params.Hidden)
+		if err != nil {
+			return nil, err
+		}
+		if review.Hidden == params.Hidden {
+			return result, nil
+		}
 
-func ListReviewsProduct(ctx context.Context, productCode string) ([]model.ReviewView, error) {
-	filter := bson.D{}
-	opts := options.Find().SetSort(bson.M{"orderID": 1})
+		sign := 1
+		if params.Hidden {
+			sign = -1
+		}
+		if err := s.countReview(ctx, *review, sign); err != nil {
+			return nil, err
+		}
 
-	cursor, err := db.ReviewCollection.Find(ctx, filter, opts)
+		return result, nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	defer cursor.Close(ctx)
 
-	var reviews []model.ReviewView
-	for cursor.Next(ctx) {
-		var reviewOrder model.ReviewOrder
-		if err = cursor.Decode(&reviewOrder); err != nil {
-			return nil, err
+	return result.(*mongo.UpdateResult), nil
+}
+
+// checkReviewProducts makes sure every reviewed product is in the order cart
+// and is reviewed at most once.
+func checkReviewProducts(order *model.Order, reviewProducts []dto.ReviewProductCreate) error {
+	reviewed := map[string]bool{}
+	for _, reviewProduct := range reviewProducts {
+		if _, ok := order.Cart[reviewProduct.ProductCode]; !ok {
+			return fmt.Errorf("%w: %s", ErrProductNotInOrder, reviewProduct.ProductCode)
 		}
-		for _, reviewProduct := range reviewOrder.ReviewProducts {
-			if reviewProduct.ProductCode == productCode {
-				newReviewProduct := model.ReviewView{
-					Username: reviewOrder.Username,
-					Rating:   reviewOrder.Rating,
-					ReviewProductCreate: dto.ReviewProductCreate{
-						ProductCode: reviewProduct.ProductCode,
-						IsLiked:     reviewProduct.IsLiked,
-						Comment:     reviewProduct.Comment,
-					},
-				}
-				reviews = append(reviews, newReviewProduct)
-			}
+		if reviewed[reviewProduct.ProductCode] {
+			return fmt.Errorf("product %s reviewed more than once", reviewProduct.ProductCode)
 		}
+		reviewed[reviewProduct.ProductCode] = true
+	}
+
+	return nil
+}
+
+// productRating is the rating given to a product, falling back to the
+// rating of the whole order.
+func productRating(review model.ReviewOrder, reviewProduct dto.ReviewProductCreate) float64 {
+	if reviewProduct.Rating > 0 {
+		return float64(reviewProduct.Rating)
+	}
+	return review.Rating
+}
+
+// ratingStar is the histogram bucket of a rating, rounded to the nearest
+// star between 1 and 5.
+func ratingStar(rating float64) string {
+	star := int(math.Round(rating))
+	if star < 1 {
+		star = 1
+	}
+	if star > 5 {
+		star = 5
 	}
+	return strconv.Itoa(star)
+}
+
+// countReview adds a review to the aggregates of its products with sign 1,
+// or takes it out with sign -1.
+func (s *Service) countReview(ctx context.Context, review model.ReviewOrder, sign int) error {
+	for _, reviewProduct := range review.ReviewProducts {
+		rating := productRating(review, reviewProduct)
+		count := repository.ReviewCount{
+			Username: review.Username,
+			Sign:     sign,
+			Rating:   rating,
+			Star:     ratingStar(rating),
+			Liked:    reviewProduct.IsLiked,
+		}
+
+		if err := s.products.CountReview(ctx, reviewProduct.ProductCode, count); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Service) ListReviews(ctx context.Context, query dto.PageQuery) (*dto.Page, error) {
+	return s.reviews.List(ctx, query)
+}
 
-	return reviews, nil
+// ListReviewsProduct lists the visible reviews of a product, each with the
+// rating given to that product.
+func (s *Service) ListReviewsProduct(ctx context.Context, productCode string, query dto.ReviewQuery) (*dto.Page, error) {
+	return s.reviews.ListByProduct(ctx, productCode, query)
 }
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"oos/dto"
+	"oos/repository"
+)
+
+// counters are the review aggregates of a product, with only the stars that
+// have reviews.
+type counters struct {
+	ReviewCount int
+	RatingSum   float64
+	LikeCount   int
+	Reviewers   int
+	Stars       map[string]int
+}
+
+func productCounters(t *testing.T, repos repository.Repositories, code string) counters {
+	t.Helper()
+
+	product := getProduct(t, repos, code)
+	c := counters{
+		ReviewCount: product.ReviewCount,
+		RatingSum:   product.RatingSum,
+		LikeCount:   product.LikeCount,
+		Reviewers:   product.UserOrders["abc1"],
+		Stars:       map[string]int{},
+	}
+	for star, count := range product.RatingHistogram {
+		if count != 0 {
+			c.Stars[star] = count
+		}
+	}
+
+	return c
+}
+
+func TestCreateReviewChecks(t *testing.T) {
+	ctx := context.Background()
+	repos := repository.NewMemory()
+	s := newTestService(repos)
+	createProduct(t, s, "a1", 1, 5)
+	review := dto.ReviewOrderCreate{
+		Rating:         4,
+		ReviewProducts: []dto.ReviewProductCreate{{ProductCode: "a1", IsLiked: true}},
+	}
+
+	cooking := insertOrder(t, repos, "Cooking", map[string]int{"a1": 1})
+	if _, err := s.CreateReview(ctx, cooking, review); !errors.Is(err, ErrOrderNotDelivered) {
+		t.Errorf("review of a cooking order: err = %v, want %v", err, ErrOrderNotDelivered)
+	}
+
+	other := insertOrder(t, repos, "Delivered", map[string]int{"b1": 1})
+	if _, err := s.CreateReview(ctx, other, review); !errors.Is(err, ErrProductNotInOrder) {
+		t.Errorf("review of a product not ordered: err = %v, want %v", err, ErrProductNotInOrder)
+	}
+
+	delivered := insertOrder(t, repos, "Delivered", map[string]int{"a1": 1})
+	if _, err := s.CreateReview(ctx, delivered, review); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateReview(ctx, delivered, review); !errors.Is(err, ErrReviewExists) {
+		t.Errorf("second review: err = %v, want %v", err, ErrReviewExists)
+	}
+
+	if c := productCounters(t, repos, "a1"); c.ReviewCount != 1 {
+		t.Errorf("a1 counted %d reviews, want 1", c.ReviewCount)
+	}
+}
+
+func TestReviewAggregates(t *testing.T) {
+	ctx := context.Background()
+	repos := repository.NewMemory()
+	s := newTestService(repos)
+	createProduct(t, s, "a1", 1, 5)
+	createProduct(t, s, "b1", 1, 5)
+	orderID := insertOrder(t, repos, "Delivered", map[string]int{"a1": 1, "b1": 1})
+
+	none := counters{Stars: map[string]int{}}
+	check := func(step string, a1 counters, b1 counters) {
+		t.Helper()
+		if got := productCounters(t, repos, "a1"); !reflect.DeepEqual(got, a1) {
+			t.Errorf("%s: a1 = %+v, want %+v", step, got, a1)
+		}
+		if got := productCounters(t, repos, "b1"); !reflect.DeepEqual(got, b1) {
+			t.Errorf("%s: b1 = %+v, want %+v", step, got, b1)
+		}
+	}
+
+	// b1 has no rating of its own and takes the rating of the order.
+	_, err := s.CreateReview(ctx, orderID, dto.ReviewOrderCreate{
+		Rating: 4,
+		ReviewProducts: []dto.ReviewProductCreate{
+			{ProductCode: "a1", IsLiked: true, Rating: 5},
+			{ProductCode: "b1", IsLiked: false},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reviewed := counters{ReviewCount: 1, RatingSum: 5, LikeCount: 1, Reviewers: 1, Stars: map[string]int{"5": 1}}
+	check("create", reviewed, counters{ReviewCount: 1, RatingSum: 4, Reviewers: 1, Stars: map[string]int{"4": 1}})
+
+	// An edit takes the old review out before counting the new one.
+	_, err = s.UpdateReview(ctx, orderID, dto.ReviewOrderCreate{
+		Rating:         2,
+		ReviewProducts: []dto.ReviewProductCreate{{ProductCode: "a1", IsLiked: false, Rating: 2}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	edited := counters{ReviewCount: 1, RatingSum: 2, Reviewers: 1, Stars: map[string]int{"2": 1}}
+	check("update", edited, none)
+
+	// Hiding twice takes the review out once.
+	for i := 0; i < 2; i++ {
+		if _, err := s.HideReview(ctx, orderID, dto.ReviewUpdateHidden{Hidden: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check("hide", none, none)
+
+	// An edit while hidden changes nothing until the review is shown again.
+	_, err = s.UpdateReview(ctx, orderID, dto.ReviewOrderCreate{
+		Rating:         3,
+		ReviewProducts: []dto.ReviewProductCreate{{ProductCode: "a1", IsLiked: true, Rating: 3}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("update hidden", none, none)
+
+	if _, err := s.HideReview(ctx, orderID, dto.ReviewUpdateHidden{Hidden: false}); err != nil {
+		t.Fatal(err)
+	}
+	check("unhide", counters{ReviewCount: 1, RatingSum: 3, LikeCount: 1, Reviewers: 1, Stars: map[string]int{"3": 1}}, none)
+
+	if _, err := s.DeleteReview(ctx, orderID); err != nil {
+		t.Fatal(err)
+	}
+	check("delete", none, none)
+}
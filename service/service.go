@@ -0,0 +1,41 @@
+package service
+
+import (
+	"go.uber.org/zap"
+
+	"oos/config"
+	"oos/repository"
+)
+
+// ErrInvalidCursor is returned by list functions given a cursor they did not issue.
+var ErrInvalidCursor = repository.ErrInvalidCursor
+
+// Service is the business logic of one application over its repositories.
+type Service struct {
+	products   repository.ProductRepository
+	orders     repository.OrderRepository
+	reviews    repository.ReviewRepository
+	users      repository.UserRepository
+	tokens     repository.TokenRepository
+	transactor repository.Transactor
+	logger     *zap.Logger
+
+	// Applied to order totals.
+	taxRate     float64
+	deliveryFee float64
+}
+
+// New builds the services of an application backed by repos.
+func New(cfg *config.Config, lg *zap.Logger, repos repository.Repositories) *Service {
+	return &Service{
+		products:    repos.Products,
+		orders:      repos.Orders,
+		reviews:     repos.Reviews,
+		users:       repos.Users,
+		tokens:      repos.Tokens,
+		transactor:  repos.Transactions,
+		logger:      lg,
+		taxRate:     cfg.Order.TaxRate,
+		deliveryFee: cfg.Order.DeliveryFee,
+	}
+}
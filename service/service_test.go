@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+
+	"oos/config"
+	"oos/db"
+	"oos/dto"
+	"oos/migrations"
+	"oos/model"
+	"oos/repository"
+)
+
+// newTestService builds a service on repos with a 10% tax and a delivery fee
+// of 3.
+func newTestService(repos repository.Repositories) *Service {
+	cfg := config.Default()
+	cfg.Order.TaxRate = 0.1
+	cfg.Order.DeliveryFee = 3
+
+	return New(cfg, zap.NewNop(), repos)
+}
+
+// mongoRepositories returns repositories on a new database of the replica set
+// at OOS_TEST_MONGO_URI, which is dropped after the test. The test is skipped
+// if the variable is not set.
+func mongoRepositories(t *testing.T) repository.Repositories {
+	t.Helper()
+
+	uri := os.Getenv("OOS_TEST_MONGO_URI")
+	if uri == "" {
+		t.Skip("OOS_TEST_MONGO_URI is not set")
+	}
+
+	cfg := config.Default()
+	cfg.DB.Host = uri
+	cfg.DB.Name = fmt.Sprintf("oos_test_%d", time.Now().UnixNano())
+	database, err := db.Connect(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ctx := context.Background()
+		database.Drop(ctx)
+		database.Client().Disconnect(ctx)
+	})
+
+	// The indexes are needed, and the collections must exist before a
+	// transaction writes to them.
+	if _, err := migrations.Up(context.Background(), database); err != nil {
+		t.Fatal(err)
+	}
+
+	return repository.NewMongo(database)
+}
+
+// eachRepositories runs test on the in-memory repositories and, if
+// OOS_TEST_MONGO_URI is set, on MongoDB.
+func eachRepositories(t *testing.T, test func(t *testing.T, repos repository.Repositories)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, repository.NewMemory())
+	})
+	t.Run("mongo", func(t *testing.T) {
+		test(t, mongoRepositories(t))
+	})
+}
+
+// createProduct adds a product that can be ordered up to limit at a time and
+// starts with limit in stock.
+func createProduct(t *testing.T, s *Service, code string, price float64, limit int) {
+	t.Helper()
+
+	params := dto.ProductCreate{
+		Code: code,
+		ProductUpdate: dto.ProductUpdate{
+			Name:     code,
+			Origin:   "Korea",
+			Price:    price,
+			Limit:    limit,
+			CanOrder: true,
+			CanView:  true,
+		},
+	}
+	if _, err := s.CreateProduct(context.Background(), params); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// createOrder orders cart as abc1 and returns the order ID.
+func createOrder(t *testing.T, s *Service, cart map[string]int) string {
+	t.Helper()
+
+	params := dto.OrderCreate{
+		User:            dto.UserCreate{Username: "abc1"},
+		OrderUpdateCart: dto.OrderUpdateCart{Cart: cart},
+	}
+	result, err := s.CreateOrder(context.Background(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return result.InsertedID.(primitive.ObjectID).Hex()
+}
+
+// insertOrder stores an order of abc1 in status directly, bypassing the
+// transitions that would lead there.
+func insertOrder(t *testing.T, repos repository.Repositories, status string, cart map[string]int) string {
+	t.Helper()
+
+	now := time.Now().UnixMicro()
+	order := model.Order{
+		ID:            primitive.NewObjectID(),
+		CreatedAt:     now,
+		UpdatedAt:     now,
+		Status:        status,
+		StatusHistory: []model.OrderStatusChange{{Status: status, ChangedAt: now, Actor: "abc1"}},
+		User:          dto.UserCreate{Username: "abc1"},
+		Cart:          cart,
+	}
+	if _, err := repos.Orders.Insert(context.Background(), order); err != nil {
+		t.Fatal(err)
+	}
+
+	return order.ID.Hex()
+}
+
+// getProduct returns the stored document of a product.
+func getProduct(t *testing.T, repos repository.Repositories, code string) *model.ProductDocument {
+	t.Helper()
+
+	product, err := repos.Products.Get(context.Background(), code)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return product
+}
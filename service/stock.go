@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+
+	"oos/config"
+	"oos/dto"
+	"oos/model"
+)
+
+// reserveStock takes each quantity out of the remaining stock of its product
+// and reports the lines that could not be reserved as a CartError. It must run
+// in a transaction so that a failed line rolls back the others.
+func (s *Service) reserveStock(ctx context.Context, quantities map[string]int) error {
+	codes := make([]string, 0, len(quantities))
+	for productCode := range quantities {
+		codes = append(codes, productCode)
+	}
+	sort.Strings(codes)
+
+	var lines []dto.CartLineError
+	for _, productCode := range codes {
+		quantity := quantities[productCode]
+		if quantity <= 0 {
+			continue
+		}
+
+		reserved, err := s.products.Reserve(ctx, productCode, quantity)
+		if err != nil {
+			return err
+		}
+		if !reserved {
+			lines = append(lines, dto.CartLineError{
+				ProductCode: productCode,
+				Quantity:    quantity,
+				Reason:      "not enough stock left",
+			})
+			continue
+		}
+
+		if err := s.products.MarkSoldOut(ctx, productCode); err != nil {
+			return err
+		}
+	}
+
+	if len(lines) > 0 {
+		return &CartError{Lines: lines}
+	}
+
+	return nil
+}
+
+// releaseStock puts quantities back into stock, reopening products that were
+// closed only because they had sold out.
+func (s *Service) releaseStock(ctx context.Context, quantities map[string]int) error {
+	for productCode, quantity := range quantities {
+		if quantity <= 0 {
+			continue
+		}
+
+		if err := s.products.Release(ctx, productCode, quantity); err != nil {
+			return err
+		}
+		if err := s.products.Reopen(ctx, productCode); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// adjustStock reserves or releases the difference between two carts.
+func (s *Service) adjustStock(ctx context.Context, before map[string]int, after map[string]int) error {
+	reserve := map[string]int{}
+	release := map[string]int{}
+	for productCode, quantity := range after {
+		if delta := quantity - before[productCode]; delta > 0 {
+			reserve[productCode] = delta
+		} else if delta < 0 {
+			release[productCode] = -delta
+		}
+	}
+	for productCode, quantity := range before {
+		if _, ok := after[productCode]; !ok {
+			release[productCode] = quantity
+		}
+	}
+
+	if err := s.reserveStock(ctx, reserve); err != nil {
+		return err
+	}
+
+	return s.releaseStock(ctx, release)
+}
+
+func (s *Service) GetStock(ctx context.Context, productCode string) (*model.ProductStock, error) {
+	product, err := s.GetProduct(ctx, productCode)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.ProductStock{
+		Code:         product.Code,
+		Limit:        product.Limit,
+		Stock:        product.Stock,
+		SoldOut:      product.SoldOut,
+		CanOrder:     product.CanOrder,
+		StockResetAt: product.StockResetAt,
+	}, nil
+}
+
+func (s *Service) UpdateStock(ctx context.Context, productCode string, params dto.StockUpdate) (*mongo.UpdateResult, error) {
+	product, err := s.GetProduct(ctx, productCode)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only reopen a product that was closed for selling out, not one the
+	// provider closed by hand.
+	closed, reopened := true, false
+	var soldOut *bool
+	if params.Stock <= 0 {
+		soldOut = &closed
+	} else if product.SoldOut {
+		soldOut = &reopened
+	}
+
+	return s.products.SetStock(ctx, productCode, params.Stock, soldOut, time.Now().UnixMicro())
+}
+
+// ResetStock refills every product that has not been reset since boundary
+// back to its limit.
+func (s *Service) ResetStock(ctx context.Context, boundary time.Time) (*mongo.UpdateResult, error) {
+	return s.products.ResetStock(ctx, boundary.UnixMicro())
+}
+
+// RunStockReset resets stock at the configured time of day and every period
+// after it until ctx is cancelled. A reset missed while the server was down is
+// applied at startup.
+func (s *Service) RunStockReset(ctx context.Context, cfg *config.Config) error {
+	cf := cfg.Stock
+
+	resetAt, err := time.Parse("15:04", cf.ResetAt)
+	if err != nil {
+		return fmt.Errorf("invalid stock reset time %q: %w", cf.ResetAt, err)
+	}
+	period := time.Duration(cf.ResetPeriod) * time.Hour
+	if period <= 0 {
+		return fmt.Errorf("invalid stock reset period %d", cf.ResetPeriod)
+	}
+
+	now := time.Now()
+	next := time.Date(now.Year(), now.Month(), now.Day(), resetAt.Hour(), resetAt.Minute(), 0, 0, now.Location())
+	for next.After(now) {
+		next = next.Add(-period)
+	}
+	for !next.Add(period).After(now) {
+		next = next.Add(period)
+	}
+	last := next
+	next = next.Add(period)
+
+	for {
+		if _, err := s.ResetStock(ctx, last); err != nil && ctx.Err() == nil {
+			s.logger.Error("stock reset failed", zap.Error(err))
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+
+		last, next = next, next.Add(period)
+	}
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"oos/dto"
+	"oos/repository"
+)
+
+// checkStock fails the test unless the product has stock left and is open or
+// closed for selling out as given.
+func checkStock(t *testing.T, repos repository.Repositories, code string, stock int, soldOut bool) {
+	t.Helper()
+
+	product := getProduct(t, repos, code)
+	if product.Stock != stock || product.SoldOut != soldOut || product.CanOrder == soldOut {
+		t.Errorf("%s has stock %d, sold out %v, can order %v; want stock %d, sold out %v",
+			code, product.Stock, product.SoldOut, product.CanOrder, stock, soldOut)
+	}
+}
+
+func TestOrdersReserveAndReleaseStock(t *testing.T) {
+	ctx := context.Background()
+	repos := repository.NewMemory()
+	s := newTestService(repos)
+	createProduct(t, s, "a1", 1, 3)
+
+	first := createOrder(t, s, map[string]int{"a1": 2})
+	checkStock(t, repos, "a1", 1, false)
+
+	params := dto.OrderCreate{
+		User:            dto.UserCreate{Username: "abc1"},
+		OrderUpdateCart: dto.OrderUpdateCart{Cart: map[string]int{"a1": 2}},
+	}
+	_, err := s.CreateOrder(ctx, params)
+	var cartErr *CartError
+	if !errors.As(err, &cartErr) || cartErr.Lines[0].Reason != "not enough stock left" {
+		t.Fatalf("err = %v, want not enough stock left", err)
+	}
+	checkStock(t, repos, "a1", 1, false)
+
+	// Taking the last one closes the product.
+	createOrder(t, s, map[string]int{"a1": 1})
+	checkStock(t, repos, "a1", 0, true)
+
+	// Cancelling gives the stock back and reopens it.
+	if _, err := s.UpdateOrderStatus(ctx, first, "customer", "abc1", dto.OrderUpdateStatus{Status: "Cancelled"}); err != nil {
+		t.Fatal(err)
+	}
+	checkStock(t, repos, "a1", 2, false)
+}
+
+func TestCartChangesAdjustStock(t *testing.T) {
+	ctx := context.Background()
+	repos := repository.NewMemory()
+	s := newTestService(repos)
+	createProduct(t, s, "a1", 1, 5)
+	orderID := createOrder(t, s, map[string]int{"a1": 1})
+	checkStock(t, repos, "a1", 4, false)
+
+	if _, err := s.UpdateOrderItems(ctx, orderID, dto.OrderUpdateCart{Cart: map[string]int{"a1": 3}}); err != nil {
+		t.Fatal(err)
+	}
+	checkStock(t, repos, "a1", 2, false)
+
+	if _, err := s.UpdateOrderItems(ctx, orderID, dto.OrderUpdateCart{Cart: map[string]int{"a1": 1}}); err != nil {
+		t.Fatal(err)
+	}
+	checkStock(t, repos, "a1", 4, false)
+
+	if _, err := s.DeleteOrderItems(ctx, orderID, []string{"a1"}); err != nil {
+		t.Fatal(err)
+	}
+	checkStock(t, repos, "a1", 5, false)
+}
+
+func TestUpdateStock(t *testing.T) {
+	ctx := context.Background()
+	repos := repository.NewMemory()
+	s := newTestService(repos)
+	createProduct(t, s, "a1", 1, 5)
+
+	if _, err := s.UpdateStock(ctx, "a1", dto.StockUpdate{Stock: 0}); err != nil {
+		t.Fatal(err)
+	}
+	checkStock(t, repos, "a1", 0, true)
+
+	if _, err := s.UpdateStock(ctx, "a1", dto.StockUpdate{Stock: 2}); err != nil {
+		t.Fatal(err)
+	}
+	checkStock(t, repos, "a1", 2, false)
+
+	// A product the provider closed stays closed when restocked.
+	if _, err := s.UpdateProduct(ctx, "a1", dto.ProductUpdate{Name: "a1", Origin: "Korea", Price: 1, Limit: 5, CanOrder: false, CanView: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.UpdateStock(ctx, "a1", dto.StockUpdate{Stock: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if product := getProduct(t, repos, "a1"); product.Stock != 3 || product.CanOrder {
+		t.Errorf("stock %d and can order %v, want 3 and false", product.Stock, product.CanOrder)
+	}
+}
+
+func TestResetStock(t *testing.T) {
+	ctx := context.Background()
+	repos := repository.NewMemory()
+	s := newTestService(repos)
+	createProduct(t, s, "a1", 1, 2)
+	createOrder(t, s, map[string]int{"a1": 2})
+	checkStock(t, repos, "a1", 0, true)
+
+	// The product was last reset when it was created, after this boundary.
+	if _, err := s.ResetStock(ctx, time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	checkStock(t, repos, "a1", 0, true)
+
+	if _, err := s.ResetStock(ctx, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	checkStock(t, repos, "a1", 2, false)
+}
+
+func TestReleaseAfterResetKeepsLimit(t *testing.T) {
+	eachRepositories(t, func(t *testing.T, repos repository.Repositories) {
+		ctx := context.Background()
+		s := newTestService(repos)
+		createProduct(t, s, "a1", 1, 3)
+		cancelled := createOrder(t, s, map[string]int{"a1": 2})
+		edited := createOrder(t, s, map[string]int{"a1": 1})
+		checkStock(t, repos, "a1", 0, true)
+
+		if _, err := s.ResetStock(ctx, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+		checkStock(t, repos, "a1", 3, false)
+
+		// The reset already gave back what these orders reserved.
+		if _, err := s.UpdateOrderStatus(ctx, cancelled, "customer", "abc1", dto.OrderUpdateStatus{Status: "Cancelled"}); err != nil {
+			t.Fatal(err)
+		}
+		checkStock(t, repos, "a1", 3, false)
+
+		if _, err := s.DeleteOrderItems(ctx, edited, []string{"a1"}); err != nil {
+			t.Fatal(err)
+		}
+		checkStock(t, repos, "a1", 3, false)
+	})
+}
@@ -0,0 +1,14 @@
+package service
+
+import (
+	"context"
+	"time"
+)
+
+func (s *Service) RevokeToken(ctx context.Context, tokenID string, username string, expiresAt time.Time) error {
+	return s.tokens.Revoke(ctx, tokenID, username, expiresAt)
+}
+
+func (s *Service) IsTokenRevoked(ctx context.Context, tokenID string) (bool, error) {
+	return s.tokens.IsRevoked(ctx, tokenID)
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"oos/dto"
+	"oos/repository"
+)
+
+func TestCreateOrderRollsBackReservedStock(t *testing.T) {
+	eachRepositories(t, func(t *testing.T, repos repository.Repositories) {
+		ctx := context.Background()
+		s := newTestService(repos)
+		createProduct(t, s, "a1", 10, 5)
+		createProduct(t, s, "b1", 10, 5)
+		if _, err := s.UpdateStock(ctx, "b1", dto.StockUpdate{Stock: 1}); err != nil {
+			t.Fatal(err)
+		}
+
+		// a1 is reserved first, then b1 fails and must take a1 back with it.
+		params := dto.OrderCreate{
+			User:            dto.UserCreate{Username: "abc1"},
+			OrderUpdateCart: dto.OrderUpdateCart{Cart: map[string]int{"a1": 2, "b1": 3}},
+		}
+		_, err := s.CreateOrder(ctx, params)
+		var cartErr *CartError
+		if !errors.As(err, &cartErr) || len(cartErr.Lines) != 1 || cartErr.Lines[0].ProductCode != "b1" {
+			t.Fatalf("err = %v, want a cart error on b1", err)
+		}
+
+		if stock := getProduct(t, repos, "a1").Stock; stock != 5 {
+			t.Errorf("a1 stock = %d, want 5", stock)
+		}
+		if stock := getProduct(t, repos, "b1").Stock; stock != 1 {
+			t.Errorf("b1 stock = %d, want 1", stock)
+		}
+		page, err := repos.Orders.List(ctx, repository.OrderFilter{}, dto.PageQuery{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := reflect.ValueOf(page.Items).Len(); n != 0 {
+			t.Errorf("%d orders stored, want 0", n)
+		}
+	})
+}
+
+func TestCreateReviewRollsBackCounters(t *testing.T) {
+	eachRepositories(t, func(t *testing.T, repos repository.Repositories) {
+		ctx := context.Background()
+		s := newTestService(repos)
+		createProduct(t, s, "a1", 10, 5)
+
+		// gone was in the cart but has no product to count the review on, so
+		// the review fails after a1 has been counted.
+		orderID := insertOrder(t, repos, "Delivered", map[string]int{"a1": 1, "gone": 1})
+		before := getProduct(t, repos, "a1")
+
+		_, err := s.CreateReview(ctx, orderID, dto.ReviewOrderCreate{
+			Rating: 4,
+			ReviewProducts: []dto.ReviewProductCreate{
+				{ProductCode: "a1", IsLiked: true, Rating: 5},
+				{ProductCode: "gone", IsLiked: true, Rating: 5},
+			},
+		})
+		if err == nil {
+			t.Fatal("review of a missing product was created")
+		}
+
+		if after := getProduct(t, repos, "a1"); !reflect.DeepEqual(after, before) {
+			t.Errorf("a1 changed from %+v to %+v", before, after)
+		}
+		if _, err := s.GetReview(ctx, orderID); !errors.Is(err, mongo.ErrNoDocuments) {
+			t.Errorf("GetReview err = %v, want mongo.ErrNoDocuments", err)
+		}
+	})
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/bcrypt"
+
+	"oos/dto"
+	"oos/model"
+	"oos/repository"
+)
+
+var (
+	ErrUserExists         = errors.New("username already taken")
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrRoleNotGranted     = errors.New("role not granted to this user")
+
+	dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+)
+
+func (s *Service) CreateUser(ctx context.Context, params dto.AccountCreate) (*mongo.InsertOneResult, error) {
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(params.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	// Registration only ever makes a customer; other roles are granted by a
+	// provider or with the -grant-provider flag.
+	user := model.User{
+		CreatedAt:    time.Now().UnixMicro(),
+		UpdatedAt:    time.Now().UnixMicro(),
+		PasswordHash: passwordHash,
+		Roles:        []string{"customer"},
+		UserCreate:   params.UserCreate,
+	}
+
+	result, err := s.users.Insert(ctx, user)
+	if errors.Is(err, repository.ErrDuplicate) {
+		return nil, ErrUserExists
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (s *Service) GrantRole(ctx context.Context, username string, role string) (*mongo.UpdateResult, error) {
+	return s.users.AddRole(ctx, username, role)
+}
+
+func (s *Service) GetUser(ctx context.Context, username string) (*model.User, error) {
+	return s.users.Get(ctx, username)
+}
+
+func (s *Service) AuthenticateUser(ctx context.Context, role string, params dto.AccountLogin) (*model.User, error) {
+	user, err := s.GetUser(ctx, params.Username)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// Hash anyway so that unknown usernames take as long as wrong passwords.
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(params.Password))
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := bcrypt.CompareHashAndPassword(user.PasswordHash, []byte(params.Password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	if !user.HasRole(role) {
+		return nil, ErrRoleNotGranted
+	}
+
+	return user, nil
+}
+
+// References
+// https://pkg.go.dev/golang.org/x/crypto/bcrypt